@@ -3,24 +3,109 @@ package main
 import (
 	"bujo/lib"
 	"flag"
+	"fmt"
 	"log"
+	"os"
 )
 
 func main() {
 	var dailyMigration bool
+	var weeklyMigration bool
 	var monthlyMigration bool
+	var interactive bool
+	var root string
+	var options lib.MigrationOptions
 
+	flag.StringVar(&root, "root", "", "Notes root directory (defaults to $BUJO_ROOT, then the root in the user config file, then ./notes)")
 	flag.BoolVar(&dailyMigration, "m", false, "Run daily migration")
+	flag.BoolVar(&weeklyMigration, "w", false, "Run weekly migration")
 	flag.BoolVar(&monthlyMigration, "M", false, "Run monthly migration")
+	flag.BoolVar(&interactive, "i", false, "Decide whether to migrate, complete, cancel or schedule each task")
+	flag.BoolVar(&options.Strict, "strict", false, "Refuse to migrate if any note file has parse errors")
+	flag.IntVar(&options.TabWidth, "tabwidth", 4, "Number of columns between tab stops when resolving indentation")
+	flag.BoolVar(&options.NormalizeIndentation, "normalize", false, "Rewrite indentation with spaces in migrated files")
+	flag.BoolVar(&options.PriorityFirst, "priority", false, "Put tasks marked as a priority first in the new note file")
+	flag.BoolVar(&options.Merge, "merge", false, "Add new tasks to the new note file if it already exists")
+	flag.BoolVar(&options.DryRun, "dry-run", false, "Print a diff of the changes the migration would make, without making them")
+	flag.BoolVar(&options.JSON, "json", false, "Print the changes from -dry-run as JSON")
+	flag.BoolVar(&options.Wait, "wait", false, "Wait for another bujo command to finish with the journal, instead of failing")
+	flag.StringVar(&options.Match, "match", "", "Only migrate tasks with all of this metadata, ex. \"#backend @alice\"")
 
 	flag.Parse()
 
+	notesRootDir, err := lib.ResolveNotesRootDir(root)
+	if err != nil {
+		log.Fatalf("Failed to find notes directory: %s", err)
+	}
+
+	switch flag.Arg(0) {
+	case "history":
+		historyFlags := flag.NewFlagSet("history", flag.ExitOnError)
+		historyFlags.Parse(flag.Args()[1:])
+		if historyFlags.NArg() != 1 {
+			log.Fatalf("Usage: bujo history <task id>")
+		}
+
+		occurrences, err := lib.TaskHistory(notesRootDir, historyFlags.Arg(0))
+		if err != nil {
+			log.Fatalf("Failed to find task history: %s", err)
+		}
+
+		for _, occurrence := range occurrences {
+			fmt.Println(occurrence)
+		}
+
+		return
+	case "stale":
+		staleFlags := flag.NewFlagSet("stale", flag.ExitOnError)
+		threshold := staleFlags.Int("threshold", 0, "List tasks migrated at least this many times (defaults to the journal config, or 3)")
+		staleFlags.Parse(flag.Args()[1:])
+		if staleFlags.NArg() != 0 {
+			log.Fatalf("Usage: bujo stale [-threshold n]")
+		}
+
+		staleTasks, err := lib.StaleTasks(notesRootDir, *threshold)
+		if err != nil {
+			log.Fatalf("Failed to find stale tasks: %s", err)
+		}
+
+		for _, staleTask := range staleTasks {
+			fmt.Println(staleTask)
+		}
+
+		return
+	case "undo":
+		undoFlags := flag.NewFlagSet("undo", flag.ExitOnError)
+		wait := undoFlags.Bool("wait", options.Wait, "Wait for another bujo command to finish with the journal, instead of failing")
+		undoFlags.Parse(flag.Args()[1:])
+		if undoFlags.NArg() != 0 {
+			log.Fatalf("Usage: bujo undo [-wait]")
+		}
+
+		if err := lib.Undo(notesRootDir, *wait); err != nil {
+			log.Fatalf("Failed to undo migration: %s", err)
+		}
+
+		return
+	case "":
+	default:
+		log.Fatalf("Unknown command: %s", flag.Arg(0))
+	}
+
+	if interactive {
+		options.Reviewer = lib.NewPromptReviewer(os.Stdin, os.Stdout)
+	}
+
 	if dailyMigration {
-		if err := lib.RunDailyMigration(); err != nil {
+		if err := lib.RunDailyMigration(notesRootDir, options); err != nil {
 			log.Fatalf("Failed to run daily migration: %s", err)
 		}
+	} else if weeklyMigration {
+		if err := lib.RunWeeklyMigration(notesRootDir, options); err != nil {
+			log.Fatalf("Failed to run weekly migration: %s", err)
+		}
 	} else if monthlyMigration {
-		if err := lib.RunMonthlyMigration(); err != nil {
+		if err := lib.RunMonthlyMigration(notesRootDir, options); err != nil {
 			log.Fatalf("Failed to run monthly migration: %s", err)
 		}
 	}
@@ -0,0 +1,191 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// A note file that a migration creates or rewrites, and its new contents
+// The contents from before are read from the file when they are needed, so that they aren't kept in memory during the migration
+type FileChange struct {
+	Path string
+	Created bool
+	noteTree NoteTree
+}
+
+// The contents of the file before the change, or "" if the file is created
+func (change FileChange) Before() (string, error) {
+	if change.Created {
+		return "", nil
+	}
+
+	fileBytes, err := os.ReadFile(change.Path)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read file: %w", err)
+	}
+
+	return string(fileBytes), nil
+}
+
+func (change FileChange) After() string {
+	return change.noteTree.String()
+}
+
+// Check whether the file already has its new contents, by comparing hashes so that neither is held in memory
+func (change FileChange) isUnchanged() (bool, error) {
+	if change.Created {
+		return false, nil
+	}
+
+	beforeHash, err := hashFile(change.Path)
+	if err != nil {
+		return false, fmt.Errorf("Failed to hash file: %w", err)
+	}
+
+	hash := sha256.New()
+	if _, err := change.noteTree.WriteTo(hash); err != nil {
+		return false, fmt.Errorf("Failed to hash note tree: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)) == beforeHash, nil
+}
+
+// Print the changes as a unified diff, or as JSON, with paths relative to the journal
+func printChanges(journal *Journal, changes []FileChange, options MigrationOptions) error {
+	out := options.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	if options.JSON {
+		type jsonFileChange struct {
+			Path string `json:"path"`
+			Before string `json:"before"` // Empty if the file is created
+			After string `json:"after"`
+			Created bool `json:"created"`
+		}
+
+		var jsonChanges []jsonFileChange
+		for _, change := range(changes) {
+			relativePath, err := filepath.Rel(journal.RootDir, change.Path)
+			if err != nil {
+				return fmt.Errorf("Failed to get relative note file path: %w", err)
+			}
+
+			before, err := change.Before()
+			if err != nil {
+				return fmt.Errorf("Failed to read note file: %w", err)
+			}
+
+			jsonChanges = append(jsonChanges, jsonFileChange{Path: filepath.ToSlash(relativePath), Before: before, After: change.After(), Created: change.Created})
+		}
+
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false) // Keep bullets like ">" readable
+		if err := encoder.Encode(jsonChanges); err != nil {
+			return fmt.Errorf("Failed to write changes: %w", err)
+		}
+
+		return nil
+	}
+
+	for _, change := range(changes) {
+		relativePath, err := filepath.Rel(journal.RootDir, change.Path)
+		if err != nil {
+			return fmt.Errorf("Failed to get relative note file path: %w", err)
+		}
+
+		oldName := "a/" + filepath.ToSlash(relativePath)
+		if change.Created {
+			oldName = "/dev/null"
+		}
+
+		before, err := change.Before()
+		if err != nil {
+			return fmt.Errorf("Failed to read note file: %w", err)
+		}
+
+		if _, err := io.WriteString(out, unifiedDiff(oldName, "b/" + filepath.ToSlash(relativePath), before, change.After())); err != nil {
+			return fmt.Errorf("Failed to write changes: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Write every change at once, and keep a copy of each file from before so that the migration can be undone
+func (j *Journal) applyChanges(changes []FileChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	previousSnapshot, err := j.readUndoSnapshot()
+	if err != nil {
+		return fmt.Errorf("Failed to read undo snapshot: %w", err)
+	}
+
+	var snapshot undoSnapshot
+	backupPaths := make(map[string]bool)
+	t := j.newTransaction()
+	for i, change := range(changes) {
+		relativePath, err := filepath.Rel(j.RootDir, change.Path)
+		if err != nil {
+			t.abort()
+			return fmt.Errorf("Failed to get relative note file path: %w", err)
+		}
+
+		file := undoFile{Path: relativePath, Created: change.Created}
+		if change.Created {
+			if file.CreatedDirs, err = j.missingDirs(change.Path); err != nil {
+				t.abort()
+				return fmt.Errorf("Failed to find missing directories: %w", err)
+			}
+		} else {
+			file.BackupPath = filepath.Join(stateDir, undoBackupDir, fmt.Sprintf("%d.note", i))
+			if err := t.stage(filepath.Join(j.RootDir, file.BackupPath), copyFile(change.Path)); err != nil {
+				return fmt.Errorf("Failed to back up note file: %w", err)
+			}
+
+			backupPaths[file.BackupPath] = true
+		}
+
+		hash := sha256.New()
+		err = t.stage(change.Path, func(w io.Writer) error {
+			_, err := change.noteTree.WriteTo(io.MultiWriter(w, hash))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to stage note file: %w", err)
+		}
+
+		file.AfterHash = hex.EncodeToString(hash.Sum(nil))
+		snapshot.Files = append(snapshot.Files, file)
+	}
+
+	// Remove the copies from the previous migration that weren't replaced
+	for _, file := range(previousSnapshot.Files) {
+		if file.BackupPath != "" && !backupPaths[file.BackupPath] {
+			if err := t.remove(filepath.Join(j.RootDir, file.BackupPath)); err != nil {
+				return fmt.Errorf("Failed to remove previous backup: %w", err)
+			}
+		}
+	}
+
+	snapshotBytes, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		t.abort()
+		return fmt.Errorf("Failed to encode undo snapshot: %w", err)
+	}
+
+	if err := t.stage(j.undoFilePath(), writeBytes(snapshotBytes)); err != nil {
+		return fmt.Errorf("Failed to stage undo snapshot: %w", err)
+	}
+
+	return t.commit()
+}
@@ -0,0 +1,58 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var journalConfigFile string = "bujo.json"
+
+// Journal-level configuration, read from bujo.json in the notes root directory
+type Config struct {
+	Bullets []BulletDefinition `json:"bullets"`
+	TaskIDs bool `json:"task_ids"` // Give tasks a stable ID when they are migrated
+	Provenance bool `json:"provenance"` // Annotate migrated tasks with where they were migrated to and from
+	StaleThreshold int `json:"stale_threshold"` // The number of migrations after which a task is stale, or 0 for the default
+	StaleAction string `json:"stale_action"` // What migrations do with stale tasks: "cancel", "flag", or nothing if empty
+	LayoutName string `json:"layout"` // Where note files go: "bujo", "iso" or "flat", or "bujo" if empty
+}
+
+func LoadConfig(notesRootDir string) (Config, error) {
+	var config Config
+
+	configBytes, err := os.ReadFile(filepath.Join(notesRootDir, journalConfigFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil // Use the defaults if there isn't a config file
+	} else if err != nil {
+		return config, fmt.Errorf("Failed to read config file: %w", err)
+	}
+
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return config, fmt.Errorf("Failed to parse config file: %w", err)
+	}
+
+	if _, err := config.Vocabulary(); err != nil {
+		return config, fmt.Errorf("Invalid config file: %w", err)
+	}
+
+	if _, err := config.Layout(); err != nil {
+		return config, fmt.Errorf("Invalid config file: %w", err)
+	}
+
+	if config.StaleAction != "" && config.StaleAction != StaleActionCancel && config.StaleAction != StaleActionFlag {
+		return config, fmt.Errorf("Invalid config file: Unknown stale action %q", config.StaleAction)
+	}
+
+	return config, nil
+}
+
+func (c Config) Vocabulary() (*Vocabulary, error) {
+	return NewVocabulary(c.Bullets)
+}
+
+func (c Config) Layout() (Layout, error) {
+	return layoutNamed(c.LayoutName)
+}
@@ -0,0 +1,190 @@
+package lib
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// The number of unchanged lines shown around each change in a unified diff
+var diffContextLines int = 3
+
+type diffLine struct {
+	kind byte // ' ' for an unchanged line, '-' for a removed line, '+' for an added line
+	text string // Includes the newline, unless it is the last line of a file without a final newline
+}
+
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines) - 1] == "" {
+		lines = lines[:len(lines) - 1]
+	}
+
+	return lines
+}
+
+// Find the shortest edit from the old lines to the new lines
+// Lines that are the same at the start and end are skipped, and the rest is compared in linear space, so that large files can be compared
+func diffLines(oldLines, newLines []string) []diffLine {
+	prefixLength := 0
+	for prefixLength < len(oldLines) && prefixLength < len(newLines) && oldLines[prefixLength] == newLines[prefixLength] {
+		prefixLength++
+	}
+
+	suffixLength := 0
+	for suffixLength < len(oldLines) - prefixLength && suffixLength < len(newLines) - prefixLength && oldLines[len(oldLines) - 1 - suffixLength] == newLines[len(newLines) - 1 - suffixLength] {
+		suffixLength++
+	}
+
+	var lines []diffLine
+	for _, line := range(oldLines[:prefixLength]) {
+		lines = append(lines, diffLine{' ', line})
+	}
+
+	lines = appendDiffLines(lines, oldLines[prefixLength:len(oldLines) - suffixLength], newLines[prefixLength:len(newLines) - suffixLength])
+
+	for _, line := range(oldLines[len(oldLines) - suffixLength:]) {
+		lines = append(lines, diffLine{' ', line})
+	}
+
+	return lines
+}
+
+// The length of the longest common subsequence of the old lines and each prefix of the new lines
+func commonLengths(oldLines, newLines []string, reversed bool) []int {
+	line := func(lines []string, i int) string {
+		if reversed {
+			return lines[len(lines) - 1 - i]
+		}
+
+		return lines[i]
+	}
+
+	previous := make([]int, len(newLines) + 1)
+	current := make([]int, len(newLines) + 1)
+	for i := range(oldLines) {
+		for j := range(newLines) {
+			if line(oldLines, i) == line(newLines, j) {
+				current[j + 1] = previous[j] + 1
+			} else {
+				current[j + 1] = max(previous[j + 1], current[j])
+			}
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous
+}
+
+// Append the edit from the old lines to the new lines, splitting the old lines in half where the longest common subsequence crosses the middle (Hirschberg's algorithm)
+func appendDiffLines(lines []diffLine, oldLines, newLines []string) []diffLine {
+	if len(oldLines) == 0 {
+		for _, line := range(newLines) {
+			lines = append(lines, diffLine{'+', line})
+		}
+
+		return lines
+	}
+
+	if len(oldLines) == 1 {
+		j := slices.Index(newLines, oldLines[0])
+		if j < 0 {
+			lines = append(lines, diffLine{'-', oldLines[0]})
+			return appendDiffLines(lines, nil, newLines)
+		}
+
+		lines = appendDiffLines(lines, nil, newLines[:j])
+		lines = append(lines, diffLine{' ', oldLines[0]})
+		return appendDiffLines(lines, nil, newLines[j + 1:])
+	}
+
+	middle := len(oldLines) / 2
+	leftLengths := commonLengths(oldLines[:middle], newLines, false)
+	rightLengths := commonLengths(oldLines[middle:], newLines, true)
+
+	split := 0
+	for k := range(leftLengths) {
+		if leftLengths[k] + rightLengths[len(newLines) - k] > leftLengths[split] + rightLengths[len(newLines) - split] {
+			split = k
+		}
+	}
+
+	lines = appendDiffLines(lines, oldLines[:middle], newLines[:split])
+	return appendDiffLines(lines, oldLines[middle:], newLines[split:])
+}
+
+// Format the difference between two texts as a unified diff, or return "" if they are the same
+func unifiedDiff(oldName, newName, oldText, newText string) string {
+	lines := diffLines(splitLines(oldText), splitLines(newText))
+
+	// The number of old and new lines before each line
+	oldLineCounts := make([]int, len(lines) + 1)
+	newLineCounts := make([]int, len(lines) + 1)
+	for k, line := range(lines) {
+		oldLineCounts[k + 1] = oldLineCounts[k]
+		newLineCounts[k + 1] = newLineCounts[k]
+		if line.kind != '+' {
+			oldLineCounts[k + 1]++
+		}
+		if line.kind != '-' {
+			newLineCounts[k + 1]++
+		}
+	}
+
+	var builder strings.Builder
+	for k := 0; k < len(lines); {
+		if lines[k].kind == ' ' {
+			k++
+			continue
+		}
+
+		// Extend the hunk until the next change is too far away to share context with
+		start := max(k - diffContextLines, 0)
+		end := k
+		for end < len(lines) {
+			if lines[end].kind != ' ' {
+				end++
+				continue
+			}
+
+			unchanged := 0
+			for end + unchanged < len(lines) && lines[end + unchanged].kind == ' ' {
+				unchanged++
+			}
+
+			if end + unchanged == len(lines) || unchanged > 2 * diffContextLines {
+				end = min(end + diffContextLines, len(lines))
+				break
+			}
+
+			end += unchanged
+		}
+
+		if builder.Len() == 0 {
+			fmt.Fprintf(&builder, "--- %s\n+++ %s\n", oldName, newName)
+		}
+
+		oldStart, oldCount := oldLineCounts[start], oldLineCounts[end] - oldLineCounts[start]
+		newStart, newCount := newLineCounts[start], newLineCounts[end] - newLineCounts[start]
+		if oldCount > 0 {
+			oldStart++
+		}
+		if newCount > 0 {
+			newStart++
+		}
+		fmt.Fprintf(&builder, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+
+		for _, line := range(lines[start:end]) {
+			builder.WriteByte(line.kind)
+			builder.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				builder.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		k = end
+	}
+
+	return builder.String()
+}
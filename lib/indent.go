@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"strings"
+)
+
+var defaultTabWidth int = 4
+
+func resolveTabWidth(tabWidth int) int {
+	if tabWidth <= 0 {
+		return defaultTabWidth
+	}
+
+	return tabWidth
+}
+
+// Get the width of an indent in columns, where each tab advances to the next multiple of the tab width
+func indentWidth(indent string, tabWidth int) int {
+	tabWidth = resolveTabWidth(tabWidth)
+
+	width := 0
+	for _, c := range(indent) {
+		if c == '\t' {
+			width += tabWidth - width % tabWidth
+			continue
+		}
+
+		width++
+	}
+
+	return width
+}
+
+func indentStyle(indent string) string {
+	hasTabs := strings.Contains(indent, "\t")
+	hasSpaces := strings.Contains(indent, " ")
+	if hasTabs && hasSpaces {
+		return "tabs and spaces"
+	} else if hasTabs {
+		return "tabs"
+	} else if hasSpaces {
+		return "spaces"
+	}
+
+	return ""
+}
+
+func normalizeIndent(line string, tabWidth int) string {
+	text := strings.TrimLeft(line, " \t")
+	indent := line[:len(line)-len(text)]
+
+	return strings.Repeat(" ", indentWidth(indent, tabWidth)) + text
+}
+
+// Replace the indentation of every note and body line with spaces, keeping the same depth
+// Lines in code blocks are left as they are
+func (noteTree NoteTree) NormalizeIndentation(tabWidth int) {
+	for _, note := range(noteTree.Notes) {
+		note.Indent = strings.Repeat(" ", note.Depth)
+
+		var fence codeFence
+		for i, line := range(note.Body) {
+			if fence.scan(line, i + 1) {
+				continue
+			}
+
+			note.Body[i] = normalizeIndent(line, tabWidth)
+		}
+
+		note.ChildNotes.NormalizeIndentation(tabWidth)
+	}
+}
@@ -0,0 +1,92 @@
+package lib
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A journal is a notes root directory, along with its configuration
+type Journal struct {
+	RootDir string
+	Config Config
+	vocabulary *Vocabulary
+	layout Layout
+}
+
+func OpenJournal(notesRootDir string) (*Journal, error) {
+	if _, err := os.Stat(notesRootDir); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Failed to stat notes directory: %w", err)
+	} else if os.IsNotExist(err) {
+		return nil, errNotesDirDoesNotExist
+	}
+
+	config, err := LoadConfig(notesRootDir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load config: %w", err)
+	}
+
+	vocabulary, err := config.Vocabulary()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create vocabulary: %w", err)
+	}
+
+	layout, err := config.Layout()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find layout: %w", err)
+	}
+
+	return &Journal{RootDir: notesRootDir, Config: config, vocabulary: vocabulary, layout: layout}, nil
+}
+
+// Find every note file in the journal, skipping hidden directories
+func (j *Journal) NoteFilePaths() ([]string, error) {
+	var noteFilePaths []string
+	err := filepath.WalkDir(j.RootDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() && path != j.RootDir && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		if !entry.IsDir() && filepath.Ext(path) == ".note" {
+			noteFilePaths = append(noteFilePaths, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find note files: %w", err)
+	}
+
+	return noteFilePaths, nil
+}
+
+func (j *Journal) readNoteFile(noteFilePath string, options ParseOptions) (NoteTree, error) {
+	options.Vocabulary = j.vocabulary
+	return readNoteFile(noteFilePath, options)
+}
+
+// Call visit for every note in every note file in the journal, in chronological order
+func (j *Journal) walkNotes(visit func(noteFilePath string, note *Note)) error {
+	noteFilePaths, err := j.NoteFilePaths()
+	if err != nil {
+		return fmt.Errorf("Failed to find note files: %w", err)
+	}
+
+	j.sortNoteFilePathsByDate(noteFilePaths)
+	for _, noteFilePath := range(noteFilePaths) {
+		noteTree, err := j.readNoteFile(noteFilePath, ParseOptions{})
+		if err != nil {
+			return fmt.Errorf("Failed to read note file: %w", err)
+		}
+
+		noteTree.Walk(func(note *Note) { visit(noteFilePath, note) })
+	}
+
+	return nil
+}
@@ -0,0 +1,281 @@
+package lib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var LayoutBujo string = "bujo"
+var LayoutISO string = "iso"
+var LayoutFlat string = "flat"
+
+// A layout decides where the note files for each day, week and month go in the notes root directory, and which day or month a note file is for
+// Paths are relative to the notes root directory
+type Layout interface {
+	DayFile(date time.Time) string
+	TasksFile(date time.Time) string // The task list for the month of the date
+	WeekFile(date time.Time) string // The weekly log for the ISO week of the date
+	ParseNoteFile(noteFilePath string) NoteFile
+}
+
+var layouts = map[string]Layout{
+	LayoutBujo: bujoLayout{},
+	LayoutISO: isoLayout{},
+	LayoutFlat: flatLayout{},
+}
+
+var defaultLayout Layout = bujoLayout{}
+
+func layoutNamed(name string) (Layout, error) {
+	if name == "" {
+		return defaultLayout, nil
+	}
+
+	layout, ok := layouts[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown layout %q", name)
+	}
+
+	return layout, nil
+}
+
+// The directory for each month, ex. "2019/dec"
+func monthDirOf(layout Layout, date time.Time) string {
+	return filepath.Dir(layout.DayFile(date))
+}
+
+// Check whether each month has its own directory in the layout, so that every note file in the directory is for the month
+func hasMonthDirs(layout Layout) bool {
+	date := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return monthDirOf(layout, date) != monthDirOf(layout, date.AddDate(0, 1, 0))
+}
+
+func firstOfMonth(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// The Monday that starts the ISO week of the date
+func weekStart(date time.Time) time.Time {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// ISO weeks belong to the year and month of their Thursday, so a week that spans two months or years is only filed under one of them
+func weekMonth(date time.Time) time.Time {
+	return firstOfMonth(weekStart(date).AddDate(0, 0, 3))
+}
+
+// The Monday that starts an ISO week, if the week exists
+func parseWeek(year, week int) (time.Time, bool) {
+	monday := weekStart(time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)).AddDate(0, 0, 7 * (week - 1)) // January 4th is always in week 1
+	if weekYear, weekNumber := monday.ISOWeek(); weekYear != year || weekNumber != week {
+		return time.Time{}, false
+	}
+
+	return monday, true
+}
+
+// Parse an ISO week written as "2020-W01"
+func parseISOWeek(name string) (time.Time, bool) {
+	yearString, weekString, ok := strings.Cut(name, "-W")
+	if !ok || len(yearString) != 4 || len(weekString) != 2 {
+		return time.Time{}, false
+	}
+
+	year, err := strconv.Atoi(yearString)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	week, err := strconv.Atoi(weekString)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return parseWeek(year, week)
+}
+
+func isoWeekName(date time.Time) string {
+	year, week := date.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// The parent directories of a note file, innermost first
+func parentDirs(noteFilePath string) []string {
+	var dirs []string
+	for dir := filepath.Dir(noteFilePath); dir != "." && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		dirs = append(dirs, filepath.Base(dir))
+	}
+
+	return dirs
+}
+
+// ex. "2019/dec/dec25.note" and "2019/dec/tasks.note"
+type bujoLayout struct{}
+
+var bujoWeekFilePrefix string = "week"
+
+func monthPrefix(month time.Month) string {
+	return strings.ToLower(month.String())[0:3] // Use the first 3 characters, ex. "jul", "aug", "sep", etc.
+}
+
+func parseMonthPrefix(prefix string) (time.Month, bool) {
+	for month := time.January; month <= time.December; month++ {
+		if prefix == monthPrefix(month) {
+			return month, true
+		}
+	}
+
+	return 0, false
+}
+
+func (bujoLayout) DayFile(date time.Time) string {
+	return filepath.Join(strconv.Itoa(date.Year()), monthPrefix(date.Month()), fmt.Sprintf("%s%d.note", monthPrefix(date.Month()), date.Day()))
+}
+
+func (bujoLayout) TasksFile(date time.Time) string {
+	return filepath.Join(strconv.Itoa(date.Year()), monthPrefix(date.Month()), defaultTasksFile)
+}
+
+func (bujoLayout) WeekFile(date time.Time) string {
+	_, week := date.ISOWeek()
+	month := weekMonth(date)
+	return filepath.Join(strconv.Itoa(month.Year()), monthPrefix(month.Month()), fmt.Sprintf("%s%02d.note", bujoWeekFilePrefix, week))
+}
+
+func (bujoLayout) ParseNoteFile(noteFilePath string) NoteFile {
+	noteFile := NoteFile{Path: noteFilePath}
+
+	dirs := parentDirs(noteFilePath)
+	if len(dirs) < 2 {
+		return noteFile
+	}
+
+	year, err := strconv.Atoi(dirs[1])
+	if err != nil {
+		return noteFile
+	}
+
+	month, ok := parseMonthPrefix(dirs[0])
+	if !ok {
+		return noteFile
+	}
+
+	name := noteFileName(noteFilePath)
+	if filepath.Base(noteFilePath) == defaultTasksFile {
+		return NoteFile{Path: noteFilePath, Date: time.Date(year, month, 1, 0, 0, 0, 0, time.UTC), Kind: NoteFileTasks}
+	} else if weekString, ok := strings.CutPrefix(name, bujoWeekFilePrefix); ok {
+		week, err := strconv.Atoi(weekString)
+		if err != nil {
+			return noteFile
+		}
+
+		monday, ok := parseWeek(year, week)
+		if !ok || weekMonth(monday).Month() != month {
+			return noteFile
+		}
+
+		return NoteFile{Path: noteFilePath, Date: monday, Kind: NoteFileWeek}
+	} else if len(name) < 4 || name[:3] != monthPrefix(month) {
+		return noteFile
+	}
+
+	day, err := strconv.Atoi(name[3:])
+	if err != nil || day < 1 {
+		return noteFile
+	}
+
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	if date.Day() != day { // ex. "feb30"
+		return noteFile
+	}
+
+	return NoteFile{Path: noteFilePath, Date: date, Kind: NoteFileDay}
+}
+
+// ex. "2019/12/2019-12-25.note" and "2019/12/tasks.note"
+type isoLayout struct{}
+
+func (isoLayout) DayFile(date time.Time) string {
+	return filepath.Join(date.Format("2006"), date.Format("01"), date.Format("2006-01-02") + ".note")
+}
+
+func (isoLayout) TasksFile(date time.Time) string {
+	return filepath.Join(date.Format("2006"), date.Format("01"), defaultTasksFile)
+}
+
+func (isoLayout) WeekFile(date time.Time) string {
+	month := weekMonth(date)
+	return filepath.Join(month.Format("2006"), month.Format("01"), isoWeekName(date) + ".note")
+}
+
+func (isoLayout) ParseNoteFile(noteFilePath string) NoteFile {
+	noteFile := NoteFile{Path: noteFilePath}
+
+	dirs := parentDirs(noteFilePath)
+	if len(dirs) < 2 {
+		return noteFile
+	}
+
+	monthDate, err := time.Parse("2006/01", dirs[1] + "/" + dirs[0])
+	if err != nil {
+		return noteFile
+	}
+
+	if filepath.Base(noteFilePath) == defaultTasksFile {
+		return NoteFile{Path: noteFilePath, Date: monthDate, Kind: NoteFileTasks}
+	} else if monday, ok := parseISOWeek(noteFileName(noteFilePath)); ok {
+		if !weekMonth(monday).Equal(monthDate) {
+			return noteFile
+		}
+
+		return NoteFile{Path: noteFilePath, Date: monday, Kind: NoteFileWeek}
+	}
+
+	date, err := time.Parse("2006-01-02", noteFileName(noteFilePath))
+	if err != nil || !firstOfMonth(date).Equal(monthDate) {
+		return noteFile
+	}
+
+	return NoteFile{Path: noteFilePath, Date: date, Kind: NoteFileDay}
+}
+
+// ex. "2019-12-25.note" and "2019-12-tasks.note", all in the notes root directory
+type flatLayout struct{}
+
+var flatTasksFileSuffix string = "-" + noteFileName(defaultTasksFile)
+
+func (flatLayout) DayFile(date time.Time) string {
+	return date.Format("2006-01-02") + ".note"
+}
+
+func (flatLayout) TasksFile(date time.Time) string {
+	return date.Format("2006-01") + flatTasksFileSuffix + ".note"
+}
+
+func (flatLayout) WeekFile(date time.Time) string {
+	return isoWeekName(date) + ".note"
+}
+
+func (flatLayout) ParseNoteFile(noteFilePath string) NoteFile {
+	noteFile := NoteFile{Path: noteFilePath}
+	if len(parentDirs(noteFilePath)) > 0 {
+		return noteFile
+	}
+
+	name := noteFileName(noteFilePath)
+	if date, err := time.Parse("2006-01-02", name); err == nil {
+		return NoteFile{Path: noteFilePath, Date: date, Kind: NoteFileDay}
+	} else if monday, ok := parseISOWeek(name); ok {
+		return NoteFile{Path: noteFilePath, Date: monday, Kind: NoteFileWeek}
+	}
+
+	if date, err := time.Parse("2006-01", strings.TrimSuffix(name, flatTasksFileSuffix)); err == nil && strings.HasSuffix(name, flatTasksFileSuffix) {
+		return NoteFile{Path: noteFilePath, Date: date, Kind: NoteFileTasks}
+	}
+
+	return noteFile
+}
@@ -3,6 +3,7 @@ package lib
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"slices"
@@ -12,186 +13,423 @@ import (
 
 var defaultNotesRootDir string = "./notes"
 var defaultTasksFile string = "tasks.note"
-var tmpNoteFile string = ".tmp.note"
 
 var errNotesDirDoesNotExist = errors.New("Notes directory does not exist")
 var errNextNoteFileExists = errors.New("Next note file already exists")
 
-func monthDir(month time.Month) string {
-	return monthPrefix(month)
+// The name of a note file, without the directory or extension
+func noteFileName(noteFilePath string) string {
+	return strings.TrimSuffix(filepath.Base(noteFilePath), filepath.Ext(noteFilePath))
 }
 
-func monthPrefix(month time.Month) string {
-	currentMonth := strings.ToLower(month.String())
-	return currentMonth[0:3] // Use the first 3 characters, ex. "jul", "aug", "sep", etc.
+type MigrationOptions struct {
+	Strict bool // Refuse to rewrite any files if a note file has parse errors
+	TabWidth int // The number of columns between tab stops when resolving indentation, or 0 for the default
+	NormalizeIndentation bool // Rewrite indentation with spaces in every file written by the migration
+	Match string // Only migrate tasks with all of this metadata, ex. "#backend @alice"
+	PriorityFirst bool // Put tasks marked as a priority first in the new note file
+	Reviewer Reviewer // Decide what happens to each task, or nil to migrate every task
+	Merge bool // Add new tasks to the new note file if it already exists, instead of refusing to migrate
+	DryRun bool // Print the changes the migration would make, instead of making them
+	JSON bool // Print the changes as JSON, instead of as a unified diff
+	Out io.Writer // Where to print the changes, or nil for stdout
+	Wait bool // Wait for another bujo command to finish with the journal, instead of failing
 }
 
-func currentYearDir(currentTime time.Time) string {
-	return fmt.Sprintf("%d", currentTime.Year())
-}
+func runMigration(journal *Journal, noteFilePaths []string, newFilePath string, options MigrationOptions) error {
+	if options.DryRun { // A dry run never changes any files, so it can't finish an interrupted migration first
+		if pending, err := journal.hasPendingTransaction(); err != nil {
+			return fmt.Errorf("Failed to check for interrupted migration: %w", err)
+		} else if pending {
+			return errMigrationInterrupted
+		}
+	} else { // The journal stays locked during a review, so that the answers apply to the files as they were read
+		unlock, err := journal.lock(options.Wait)
+		if err != nil {
+			return err
+		}
+		defer unlock()
 
-func previousYearDir(currentTime time.Time) string {
-	return fmt.Sprintf("%d", currentTime.Year() - 1)
-}
+		if err := journal.recoverTransaction(); err != nil {
+			return fmt.Errorf("Failed to recover interrupted migration: %w", err)
+		}
+	}
 
-func currentMonthDir(currentTime time.Time) string {
-	return monthDir(currentTime.Month())
-}
+	changes, err := planMigration(journal, noteFilePaths, newFilePath, options)
+	if err != nil {
+		return err
+	}
 
-func previousMonthDir(currentTime time.Time) string {
-	return monthDir(currentTime.Month() - 1)
-}
+	if options.DryRun {
+		return printChanges(journal, changes, options)
+	}
 
-func nextNoteFile(currentTime time.Time) string {
-	return fmt.Sprintf("%s%d.note", monthPrefix(currentTime.Month()), currentTime.Day())
+	return journal.applyChanges(changes)
 }
 
-func runMigration(notesDir, newFilePath string, ignoredFilePaths []string) error {
+// Work out the new contents of the new note file and every source note file, without changing any files
+func planMigration(journal *Journal, noteFilePaths []string, newFilePath string, options MigrationOptions) ([]FileChange, error) {
+	mergeIntoNewFile := false
 	if _, err := os.Stat(newFilePath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("Failed to stat notes directory: %w", err)
+		return nil, fmt.Errorf("Failed to stat notes directory: %w", err)
 	} else if os.IsNotExist(err) {
-		goto createTargetDirectory
+		goto migration
+	} else if options.Merge {
+		mergeIntoNewFile = true
+		goto migration
 	}
 
-	return errNextNoteFileExists
+	return nil, errNextNoteFileExists
 
-createTargetDirectory:
+migration:
 
-	targetMonthDir := filepath.Dir(newFilePath)
-	if _, err := os.Stat(targetMonthDir); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("Failed to stat notes directory: %w", err)
-	} else if os.IsNotExist(err) {
-		// Continue to create target directory
-	} else {
-		goto migration
+	// The new note file is never a source, even if it is in the same directory as the sources
+	noteFilePaths = slices.DeleteFunc(slices.Clone(noteFilePaths), func(noteFilePath string) bool { return noteFilePath == newFilePath })
+
+	var existingNoteTree NoteTree
+	if mergeIntoNewFile {
+		var err error
+		existingNoteTree, err = journal.readNoteFile(newFilePath, ParseOptions{Strict: options.Strict, TabWidth: options.TabWidth})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read new note file: %w", err)
+		}
 	}
 
-	if err := os.MkdirAll(targetMonthDir, 0755); err != nil {
-		return fmt.Errorf("Failed to create directory for new note file: %w", err)
+	noteFileNoteTrees := make(map[string]NoteTree)
+	for _, noteFilePath := range(noteFilePaths) {
+		noteTree, err := journal.readNoteFile(noteFilePath, ParseOptions{Strict: options.Strict, TabWidth: options.TabWidth})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read note file: %w", err)
+		}
+
+		noteFileNoteTrees[noteFilePath] = noteTree
 	}
 
-migration:
+	matchesOptions := func(note *Note) bool { return note.MatchesMetadata(options.Match) }
+	isMigrationCandidate := func(note *Note) bool { return note.IsUnmigrated() && matchesOptions(note) }
 
-	noteFilePattern := filepath.Join(notesDir, "*.note")
-	allNoteFilePaths, err := filepath.Glob(noteFilePattern)
-	if err != nil {
-		return fmt.Errorf("Failed to find note file paths: %w", err)
+	// Cancel or flag tasks that have already been migrated too many times, instead of silently copying them again
+	var isStale func(note *Note) bool
+	if journal.Config.StaleAction != "" {
+		migrationCounts, err := journal.migrationCounts()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to count migrations: %w", err)
+		}
+
+		// The counts are from before any task IDs are assigned below, and a task that is given an ID keeps the count of its title
+		isStale = func(note *Note) bool { return isMigrationCandidate(note) && migrationCounts.of(note) >= journal.staleThreshold() }
 	}
 
-	var noteFilePaths []string
-	for _, noteFilePath := range(allNoteFilePaths) {
-		if slices.ContainsFunc(ignoredFilePaths, func(ignoredFilePath string) bool { return filepath.Base(noteFilePath) == ignoredFilePath }) {
-			continue
+	if journal.Config.TaskIDs {
+		taskIDs, err := journal.taskIDs()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find task IDs: %w", err)
 		}
 
-		noteFilePaths = append(noteFilePaths, noteFilePath)
+		for _, noteFilePath := range(noteFilePaths) {
+			relativeNoteFilePath, err := filepath.Rel(journal.RootDir, noteFilePath)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to get relative note file path: %w", err)
+			}
+
+			noteFileNoteTrees[noteFilePath].AssignTaskIDs(isMigrationCandidate, func(note *Note) string {
+				return generateTaskID(fmt.Sprintf("%s:%d:%s", relativeNoteFilePath, note.Line, note.Title), taskIDs)
+			})
+		}
 	}
 
-	noteFileNoteTrees := make(map[string]NoteTree)
+	// Candidates that the stale action or the review close are withdrawn from the migration, along with everything under them
+	candidateNotes := make(map[*Note]bool)
 	for _, noteFilePath := range(noteFilePaths) {
-		noteFileText, err := readFileText(noteFilePath)
-		if err != nil {
-			return fmt.Errorf("Failed to read note file: %w", err)
+		noteFileNoteTrees[noteFilePath].Walk(func(note *Note) {
+			if isMigrationCandidate(note) {
+				candidateNotes[note] = true
+			}
+		})
+	}
+
+	withdrawnLines := func(noteTree NoteTree) map[int]bool {
+		return noteTree.selectLines(func(note *Note, parentSelected bool) bool {
+			return parentSelected || candidateNotes[note] && !isMigrationCandidate(note)
+		})
+	}
+
+	if journal.Config.StaleAction == StaleActionCancel {
+		for _, noteFilePath := range(noteFilePaths) {
+			noteFileNoteTrees[noteFilePath].Walk(func(note *Note) {
+				if isStale(note) {
+					note.withdraw(BulletCancelled, isMigrationCandidate)
+				}
+			})
 		}
+	}
 
-		noteTree, err := ParseNoteTree(noteFileText)
-		if err != nil {
-			return fmt.Errorf("Failed to parse note tree: %w", err)
+	if options.Reviewer != nil {
+		for _, noteFilePath := range(noteFilePaths) {
+			if err := noteFileNoteTrees[noteFilePath].Review(noteFilePath, options.Reviewer, isMigrationCandidate); err != nil {
+				return nil, fmt.Errorf("Failed to review tasks: %w", err)
+			}
 		}
+	}
 
-		noteFileNoteTrees[noteFilePath] = noteTree
+	// The notes copied to the new note file are the migration candidates and everything under them, and exactly these notes are migrated in the source files
+	noteFileCopiedLines := make(map[string]map[int]bool)
+	for _, noteFilePath := range(noteFilePaths) {
+		withdrawn := withdrawnLines(noteFileNoteTrees[noteFilePath])
+		noteFileCopiedLines[noteFilePath] = noteFileNoteTrees[noteFilePath].selectLines(func(note *Note, parentSelected bool) bool {
+			return !withdrawn[note.Line] && (parentSelected || isMigrationCandidate(note))
+		})
 	}
 
-	var newNoteTree NoteTree
+	newNoteTree := NoteTree{FinalNewline: true}
 	for _, noteFilePath := range(noteFilePaths) {
-		noteTree := noteFileNoteTrees[noteFilePath]
-		noteTreeCopy := noteTree.Copy()
-		if err := noteTreeCopy.FilterIncompleteTasks(); err != nil {
-			return fmt.Errorf("Failed to filter incomplete tasks: %w", err)
+		copiedLines := noteFileCopiedLines[noteFilePath]
+		isCopied := func(note *Note) bool { return copiedLines[note.Line] }
+
+		noteTreeCopy := noteFileNoteTrees[noteFilePath].Copy()
+		noteTreeCopy.Prune(isCopied)
+
+		if journal.Config.StaleAction == StaleActionFlag {
+			noteTreeCopy.Walk(func(note *Note) {
+				if isStale(note) && !note.HasTag(staleTag) {
+					note.appendToTitle("#" + staleTag)
+				}
+			})
+		}
+
+		if journal.Config.Provenance {
+			noteTreeCopy.Walk(func(note *Note) {
+				if isCopied(note) && note.IsUnmigrated() {
+					note.SetMigratedFrom(noteFileName(noteFilePath))
+				}
+			})
 		}
 
 		newNoteTree.Merge(noteTreeCopy)
 	}
 
-	if err = os.WriteFile(newFilePath, []byte(newNoteTree.String() + "\n"), 0644); err != nil {
-		return fmt.Errorf("Failed to write new note file: %w", err)
+	if options.PriorityFirst {
+		newNoteTree.SortPriorityFirst()
+	}
+
+	if options.NormalizeIndentation {
+		newNoteTree.NormalizeIndentation(options.TabWidth)
 	}
 
-	// Use temporary file + rename to ensure that note files are replaced atomically
-	tmpNoteFilePath := filepath.Join(notesDir, tmpNoteFile)
-	if err = os.RemoveAll(tmpNoteFilePath); err != nil { // Ensure that tmp notes file is removed if it exists
-		return fmt.Errorf("Failed to remove temporary notes file: %w", err)
+	// Copied tasks that are already open in the new note file are merged into them, instead of being added again
+	if mergeIntoNewFile {
+		existingNoteTree.mergeNew(newNoteTree)
+		newNoteTree = existingNoteTree
 	}
 
+	changes := []FileChange{{Path: newFilePath, Created: !mergeIntoNewFile, noteTree: newNoteTree}}
 	for _, noteFilePath := range(noteFilePaths) {
 		noteTree := noteFileNoteTrees[noteFilePath]
-		if err := noteTree.MigrateAll(); err != nil {
-			return fmt.Errorf("Failed to migrate notes: %w", err)
+		copiedLines := noteFileCopiedLines[noteFilePath]
+		isCopied := func(note *Note) bool { return copiedLines[note.Line] }
+
+		if journal.Config.Provenance {
+			noteTree.Walk(func(note *Note) {
+				if isCopied(note) && note.IsUnmigrated() {
+					note.SetMigratedTo(noteFileName(newFilePath))
+				}
+			})
 		}
 
-		if err = os.WriteFile(tmpNoteFilePath, []byte(noteTree.String() + "\n"), 0644); err != nil {
-			return fmt.Errorf("Failed to write new note file: %w", err)
+		if err := noteTree.MigrateMatching(isCopied); err != nil {
+			return nil, fmt.Errorf("Failed to migrate notes: %w", err)
 		}
 
-		if err = os.Rename(tmpNoteFilePath, noteFilePath); err != nil {
-			return fmt.Errorf("Failed to rename temporary note file: %w", err)
+		if options.NormalizeIndentation {
+			noteTree.NormalizeIndentation(options.TabWidth)
 		}
+
+		changes = append(changes, FileChange{Path: noteFilePath, noteTree: noteTree})
 	}
 
-	return nil
+	// Files that the migration leaves as they were aren't rewritten, so they can still be undone after being edited
+	var changedFiles []FileChange
+	for _, change := range(changes) {
+		unchanged, err := change.isUnchanged()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to compare note file: %w", err)
+		}
+
+		if !unchanged {
+			changedFiles = append(changedFiles, change)
+		}
+	}
+
+	return changedFiles, nil
 }
 
-func runDailyMigration(notesRootDir string, currentTime time.Time) error {
-	if _, err := os.Stat(notesRootDir); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("Failed to stat notes directory: %w", err)
-	} else if os.IsNotExist(err) {
-		return errNotesDirDoesNotExist
+// The note files for a month in chronological order: its daily note files, and its weekly logs and task list if includeTasks is set
+// In layouts where each month has its own directory, any other note files in the directory are included as well
+func (j *Journal) monthNoteFilePaths(month time.Time, includeTasks bool) ([]string, error) {
+	allNoteFilePaths, err := filepath.Glob(filepath.Join(j.RootDir, monthDirOf(j.layout, month), "*.note"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find note file paths: %w", err)
 	}
 
-	targetMonthDir := filepath.Join(notesRootDir, currentYearDir(currentTime), currentMonthDir(currentTime))
-	targetNoteFile := filepath.Join(targetMonthDir, nextNoteFile(currentTime))
+	var noteFilePaths []string
+	for _, noteFilePath := range(allNoteFilePaths) {
+		noteFile := j.parseNoteFile(noteFilePath)
+		if noteFile.Kind == NoteFileOther && hasMonthDirs(j.layout) || noteFile.Kind == NoteFileDay && noteFile.IsFor(month) || includeTasks && noteFile.Kind != NoteFileOther && noteFile.IsFor(month) {
+			noteFilePaths = append(noteFilePaths, noteFilePath)
+		}
+	}
 
-	ignoredFilePaths := []string{defaultTasksFile}
+	j.sortNoteFilePaths(noteFilePaths)
 
-	return runMigration(targetMonthDir, targetNoteFile, ignoredFilePaths)
+	return noteFilePaths, nil
 }
 
-func runMonthlyMigration(notesRootDir string, currentTime time.Time) error {
-	if _, err := os.Stat(notesRootDir); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("Failed to stat notes directory: %w", err)
-	} else if os.IsNotExist(err) {
-		return errNotesDirDoesNotExist
+// The earliest month with a daily note file or task list in the journal, or the zero time if there aren't any
+func (j *Journal) firstMonth() (time.Time, error) {
+	noteFilePaths, err := j.NoteFilePaths()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Failed to find note files: %w", err)
+	}
+
+	var month time.Time
+	for _, noteFilePath := range(noteFilePaths) {
+		noteFile := j.parseNoteFile(noteFilePath)
+		if noteFile.Kind != NoteFileOther && (month.IsZero() || noteFile.Date.Before(month)) {
+			month = firstOfMonth(noteFile.Date)
+		}
 	}
 
-	targetMonthDir := filepath.Join(notesRootDir, currentYearDir(currentTime), currentMonthDir(currentTime))
-	targetNoteFile := filepath.Join(targetMonthDir, defaultTasksFile)
+	return month, nil
+}
 
-	var prevNotesDir string
-	if currentTime.Month() == time.January {
-		prevNotesDir = filepath.Join(notesRootDir, previousYearDir(currentTime), monthDir(time.December))
-	} else {
-		prevNotesDir = filepath.Join(notesRootDir, currentYearDir(currentTime), previousMonthDir(currentTime))
+// The daily note files to migrate from: the ones in the current month, or if there aren't any yet, the ones in the most recent month that has any
+// Monthly task lists are never included, and the new note file doesn't count as a daily note file to migrate from
+// If no month has any, the other note files in the current month are migrated, so a new journal still gets its first daily note file
+func (j *Journal) dailyNoteFilePaths(currentTime time.Time, newFilePath string) ([]string, error) {
+	earliestMonth, err := j.firstMonth()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find earliest month: %w", err)
 	}
 
-	ignoredFilePaths := []string{}
+	for month := firstOfMonth(currentTime); !earliestMonth.IsZero() && !month.Before(earliestMonth); month = month.AddDate(0, -1, 0) {
+		noteFilePaths, err := j.monthNoteFilePaths(month, false)
+		if err != nil {
+			return nil, err
+		}
 
-	return runMigration(prevNotesDir, targetNoteFile, ignoredFilePaths)
+		hasDayFiles := slices.ContainsFunc(noteFilePaths, func(noteFilePath string) bool {
+			return noteFilePath != newFilePath && j.parseNoteFile(noteFilePath).Kind == NoteFileDay
+		})
+		if hasDayFiles {
+			return noteFilePaths, nil
+		}
+	}
+
+	return j.monthNoteFilePaths(firstOfMonth(currentTime), false)
 }
 
-func RunDailyMigration() error {
+// The weekly log and daily note files for the ISO week before the week of the current time, which may be in two months or two years
+func (j *Journal) weeklyNoteFilePaths(currentTime time.Time) ([]string, error) {
+	weekEnd := weekStart(currentTime)
+	weekStart := weekEnd.AddDate(0, 0, -7)
+
+	months := []time.Time{firstOfMonth(weekStart)}
+	if lastMonth := firstOfMonth(weekEnd.AddDate(0, 0, -1)); !lastMonth.Equal(months[0]) {
+		months = append(months, lastMonth)
+	}
+
+	// The weekly log of last week comes first, since its tasks were carried into the week before any of its days
+	var weekNoteFilePaths, noteFilePaths []string
+	for _, month := range(months) {
+		monthNoteFilePaths, err := j.monthNoteFilePaths(month, true)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, noteFilePath := range(monthNoteFilePaths) {
+			noteFile := j.parseNoteFile(noteFilePath)
+			if noteFile.Kind == NoteFileWeek && noteFile.Date.Equal(weekStart) {
+				weekNoteFilePaths = append(weekNoteFilePaths, noteFilePath)
+			} else if noteFile.Kind == NoteFileDay && !noteFile.Date.Before(weekStart) && noteFile.Date.Before(weekEnd) {
+				noteFilePaths = append(noteFilePaths, noteFilePath)
+			}
+		}
+	}
+
+	return append(weekNoteFilePaths, noteFilePaths...), nil
+}
+
+func runDailyMigration(notesRootDir string, currentTime time.Time, options MigrationOptions) error {
+	journal, err := OpenJournal(notesRootDir)
+	if err != nil {
+		return fmt.Errorf("Failed to open journal: %w", err)
+	}
+
+	targetNoteFile := filepath.Join(notesRootDir, journal.layout.DayFile(currentTime))
+
+	noteFilePaths, err := journal.dailyNoteFilePaths(currentTime, targetNoteFile)
+	if err != nil {
+		return fmt.Errorf("Failed to find daily note files: %w", err)
+	}
+
+	return runMigration(journal, noteFilePaths, targetNoteFile, options)
+}
+
+func runMonthlyMigration(notesRootDir string, currentTime time.Time, options MigrationOptions) error {
+	journal, err := OpenJournal(notesRootDir)
+	if err != nil {
+		return fmt.Errorf("Failed to open journal: %w", err)
+	}
+
+	targetNoteFile := filepath.Join(notesRootDir, journal.layout.TasksFile(currentTime))
+
+	noteFilePaths, err := journal.monthNoteFilePaths(firstOfMonth(currentTime).AddDate(0, -1, 0), true)
+	if err != nil {
+		return err
+	}
+
+	return runMigration(journal, noteFilePaths, targetNoteFile, options)
+}
+
+func runWeeklyMigration(notesRootDir string, currentTime time.Time, options MigrationOptions) error {
+	journal, err := OpenJournal(notesRootDir)
+	if err != nil {
+		return fmt.Errorf("Failed to open journal: %w", err)
+	}
+
+	targetNoteFile := filepath.Join(notesRootDir, journal.layout.WeekFile(currentTime))
+
+	noteFilePaths, err := journal.weeklyNoteFilePaths(currentTime)
+	if err != nil {
+		return fmt.Errorf("Failed to find weekly note files: %w", err)
+	}
+
+	return runMigration(journal, noteFilePaths, targetNoteFile, options)
+}
+
+func RunDailyMigration(notesRootDir string, options MigrationOptions) error {
 	currentTime := time.Now()
-	if err := runDailyMigration(defaultNotesRootDir, currentTime); err != nil {
+	if err := runDailyMigration(notesRootDir, currentTime, options); err != nil {
 		return fmt.Errorf("Error running daily migration: %w", err)
 	}
 
 	return nil
 }
 
-func RunMonthlyMigration() error {
+func RunMonthlyMigration(notesRootDir string, options MigrationOptions) error {
 	currentTime := time.Now()
-	if err := runMonthlyMigration(defaultNotesRootDir, currentTime); err != nil {
+	if err := runMonthlyMigration(notesRootDir, currentTime, options); err != nil {
 		return fmt.Errorf("Error running monthly migration: %w", err)
 	}
 
 	return nil
 }
+
+func RunWeeklyMigration(notesRootDir string, options MigrationOptions) error {
+	currentTime := time.Now()
+	if err := runWeeklyMigration(notesRootDir, currentTime, options); err != nil {
+		return fmt.Errorf("Error running weekly migration: %w", err)
+	}
+
+	return nil
+}
@@ -2,9 +2,14 @@ package lib
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -123,7 +128,7 @@ func TestRunDailyMigration(t *testing.T) {
 
 	copyDir(t, "./test/dec", filepath.Join(notesRootDir, "2019", "dec"))
 
-	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t)); err != nil {
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); err != nil {
 		t.Fatalf("Failed to run daily migration: %v", err)
 	}
 
@@ -132,8 +137,127 @@ func TestRunDailyMigration(t *testing.T) {
 	}
 }
 
+func TestRunDailyMigrationFromPreviousYear(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	copyDir(t, "./test/dec", filepath.Join(notesRootDir, "2019", "dec"))
+
+	// The monthly task list doesn't count as a daily note file
+	janNotesDir := filepath.Join(notesRootDir, "2020", "jan")
+	if err := os.MkdirAll(janNotesDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(janNotesDir, "tasks.note"), []byte("* plan the year\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := runDailyMigration(notesRootDir, monthlyMigrationTime(t), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	tasksContents, err := os.ReadFile(filepath.Join(janNotesDir, "tasks.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(tasksContents) != "* plan the year\n" {
+		t.Fatalf("Unexpected tasks file contents: %q", tasksContents)
+	}
+
+	// The new file has the same tasks as a migration on dec25
+	if err := os.Rename(filepath.Join(janNotesDir, "jan1.note"), filepath.Join(notesRootDir, "2019", "dec", "dec25.note")); err != nil {
+		t.Fatalf("Failed to rename new note file: %v", err)
+	}
+
+	if !testFilesEqual(t, "./test/expected-dec", filepath.Join(notesRootDir, "2019", "dec")) {
+		t.Fatal("Migrated files do not match expected files")
+	}
+}
+
+func TestRunDailyMigrationOnFirstOfMonthMergesIntoExistingFile(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	// Neither the new note file nor other note files count as daily note files for January
+	noteFiles := map[string]string{
+		filepath.Join("2019", "dec", "dec31.note"): "* call bank\n",
+		filepath.Join("2020", "jan", "jan1.note"): "- happy new year\n",
+		filepath.Join("2020", "jan", "ideas.note"): "* start a podcast\n",
+	}
+	for path, contents := range noteFiles {
+		noteFilePath := filepath.Join(notesRootDir, path)
+		if err := os.MkdirAll(filepath.Dir(noteFilePath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(noteFilePath, []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	if err := runDailyMigration(notesRootDir, monthlyMigrationTime(t), MigrationOptions{Merge: true}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	expectedNoteFiles := map[string]string{
+		filepath.Join("2019", "dec", "dec31.note"): "> call bank\n",
+		filepath.Join("2020", "jan", "jan1.note"): "- happy new year\n* call bank\n",
+		filepath.Join("2020", "jan", "ideas.note"): "* start a podcast\n",
+	}
+	for path, expectedContents := range expectedNoteFiles {
+		contents, err := os.ReadFile(filepath.Join(notesRootDir, path))
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		if string(contents) != expectedContents {
+			t.Fatalf("Unexpected contents of %s: %q", path, contents)
+		}
+	}
+}
+
+func TestRunDailyMigrationCreatesFileInEmptyJournal(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	contents, err := os.ReadFile(filepath.Join(notesRootDir, "2019", "dec", "dec25.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(contents) != "" {
+		t.Fatalf("Unexpected new file contents: %q", contents)
+	}
+}
+
+func TestRunDailyMigrationMigratesOtherNoteFilesWithoutDailyNoteFiles(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	if err := os.MkdirAll(notesDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(notesDir, "ideas.note"), []byte("* start a podcast\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	contents, err := os.ReadFile(filepath.Join(notesDir, "dec25.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(contents) != "* start a podcast\n" {
+		t.Fatalf("Unexpected new file contents: %q", contents)
+	}
+}
+
 func TestRunDailyMigrationReturnsErrorIfNotesDirectoryDoesNotExist(t *testing.T) {
-	if err := runDailyMigration("non-existent-dir", dailyMigrationTime(t)); !errors.Is(err, errNotesDirDoesNotExist) {
+	if err := runDailyMigration("non-existent-dir", dailyMigrationTime(t), MigrationOptions{}); !errors.Is(err, errNotesDirDoesNotExist) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 }
@@ -148,7 +272,7 @@ func TestRunDailyMigrationReturnsErrorIfTargetFileAlreadyExists(t *testing.T) {
 		t.Fatalf("Failed to write file: %v", err)
 	}
 
-	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t)); !errors.Is(err, errNextNoteFileExists) {
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); !errors.Is(err, errNextNoteFileExists) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 }
@@ -159,7 +283,7 @@ func TestRunMonthlyMigration(t *testing.T) {
 
 	copyDir(t, "./test/dec", filepath.Join(notesRootDir, "2019", "dec"))
 
-	if err := runMonthlyMigration(notesRootDir, monthlyMigrationTime(t)); err != nil {
+	if err := runMonthlyMigration(notesRootDir, monthlyMigrationTime(t), MigrationOptions{}); err != nil {
 		t.Fatalf("Failed to run monthly migration: %v", err)
 	}
 
@@ -169,7 +293,7 @@ func TestRunMonthlyMigration(t *testing.T) {
 }
 
 func TestRunMonthlyMigrationReturnsErrorIfNotesDirectoryDoesNotExist(t *testing.T) {
-	if err := runMonthlyMigration("non-existent-dir", monthlyMigrationTime(t)); !errors.Is(err, errNotesDirDoesNotExist) {
+	if err := runMonthlyMigration("non-existent-dir", monthlyMigrationTime(t), MigrationOptions{}); !errors.Is(err, errNotesDirDoesNotExist) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 }
@@ -188,7 +312,1328 @@ func TestRunMonthlyMigrationReturnsErrorIfTargetFileAlreadyExists(t *testing.T)
 		t.Fatalf("Failed to write file: %v", err)
 	}
 
-	if err := runMonthlyMigration(notesRootDir, monthlyMigrationTime(t)); !errors.Is(err, errNextNoteFileExists) {
+	if err := runMonthlyMigration(notesRootDir, monthlyMigrationTime(t), MigrationOptions{}); !errors.Is(err, errNextNoteFileExists) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestRunDailyMigrationPreservesSourceFileText(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	if err := os.MkdirAll(notesDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(notesDir, "dec24.note"), []byte("Christmas Eve  \n\n* wrap presents\t\n- no final newline"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	sourceContents, err := os.ReadFile(filepath.Join(notesDir, "dec24.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(sourceContents) != "Christmas Eve  \n\n> wrap presents\t\n- no final newline" {
+		t.Fatalf("Unexpected source file contents: %q", sourceContents)
+	}
+
+	newContents, err := os.ReadFile(filepath.Join(notesDir, "dec25.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(newContents) != "* wrap presents\t\n" {
+		t.Fatalf("Unexpected new file contents: %q", newContents)
+	}
+}
+
+func TestRunDailyMigrationInStrictModeRefusesToRewriteFilesWithErrors(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	copyDir(t, "./test/dec", notesDir)
+
+	if err := os.WriteFile(filepath.Join(notesDir, "dec24.note"), []byte("- a\n    * a.1\n  * a.2\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{Strict: true})
+
+	var parseErrors ParseErrors
+	if !errors.As(err, &parseErrors) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
+
+	if parseErrors[0].File != filepath.Join(notesDir, "dec24.note") || parseErrors[0].Line != 3 {
+		t.Fatalf("Unexpected parse errors: %v", parseErrors)
+	}
+
+	if _, err := os.Stat(filepath.Join(notesDir, "dec25.note")); !os.IsNotExist(err) {
+		t.Fatalf("New note file was created: %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(notesDir, "dec24.note")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+
+	if !testFilesEqual(t, "./test/dec", notesDir) {
+		t.Fatal("Note files were rewritten")
+	}
+}
+
+func TestRunDailyMigrationOnlyMigratesMatchingTasks(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	if err := os.MkdirAll(notesDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(notesDir, "dec24.note"), []byte("- work\n  * fix login #backend @alice\n    * write test\n    x reproduce\n  * fix layout #frontend\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{Match: "#backend"}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	sourceContents, err := os.ReadFile(filepath.Join(notesDir, "dec24.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(sourceContents) != "- work\n  > fix login #backend @alice\n    > write test\n    x reproduce\n  * fix layout #frontend\n" {
+		t.Fatalf("Unexpected source file contents: %q", sourceContents)
+	}
+
+	newContents, err := os.ReadFile(filepath.Join(notesDir, "dec25.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(newContents) != "- work\n  * fix login #backend @alice\n    * write test\n    x reproduce\n" {
+		t.Fatalf("Unexpected new file contents: %q", newContents)
+	}
+
+	// The child task was migrated with its parent, so it isn't copied again
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t).AddDate(0, 0, 1), MigrationOptions{Match: "#backend"}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	newContents, err = os.ReadFile(filepath.Join(notesDir, "dec26.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(newContents) != "- work\n  * fix login #backend @alice\n    * write test\n    x reproduce\n" {
+		t.Fatalf("Unexpected new file contents: %q", newContents)
+	}
+}
+
+func TestRunDailyMigrationUsesConfiguredBullets(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	config := `{"bullets": [{"symbol": "/", "name": "in progress", "open": true, "migrates_to": ">", "carry_forward": true}, {"symbol": "!", "name": "blocked", "open": true}]}`
+	if err := os.WriteFile(filepath.Join(notesRootDir, "bujo.json"), []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	if err := os.MkdirAll(notesDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(notesDir, "dec24.note"), []byte("/ write speech\n! buy cake\n* call caterer\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	sourceContents, err := os.ReadFile(filepath.Join(notesDir, "dec24.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(sourceContents) != "> write speech\n! buy cake\n> call caterer\n" {
+		t.Fatalf("Unexpected source file contents: %q", sourceContents)
+	}
+
+	newContents, err := os.ReadFile(filepath.Join(notesDir, "dec25.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(newContents) != "/ write speech\n* call caterer\n" {
+		t.Fatalf("Unexpected new file contents: %q", newContents)
+	}
+}
+
+func TestRunDailyMigrationGivesTasksStableIDs(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	if err := os.WriteFile(filepath.Join(notesRootDir, "bujo.json"), []byte(`{"task_ids": true}`), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	if err := os.MkdirAll(notesDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(notesDir, "dec24.note"), []byte("- errands\n  * call bank\n  * pay rent ^rent\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t).AddDate(0, 0, 1), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	journal, err := OpenJournal(notesRootDir)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+
+	noteTree, err := journal.readNoteFile(filepath.Join(notesDir, "dec26.note"), ParseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to read note file: %v", err)
+	}
+
+	callBankNote := noteTree.Notes[0].ChildNotes.Notes[0]
+	if len(callBankNote.ID) != taskIDLength || callBankNote.Title != "call bank ^" + callBankNote.ID {
+		t.Fatalf("Unexpected note: %s", callBankNote.Text())
+	}
+
+	if payRentNote := noteTree.Notes[0].ChildNotes.Notes[1]; payRentNote.Title != "pay rent ^rent" {
+		t.Fatalf("Unexpected note: %s", payRentNote.Text())
+	}
+
+	occurrences, err := journal.TaskHistory(callBankNote.ID)
+	if err != nil {
+		t.Fatalf("Failed to find task history: %v", err)
+	}
+
+	expectedOccurrences := []TaskOccurrence{
+		{Path: filepath.Join(notesDir, "dec24.note"), Line: 2, Bullet: BulletMigrated},
+		{Path: filepath.Join(notesDir, "dec25.note"), Line: 2, Bullet: BulletMigrated},
+		{Path: filepath.Join(notesDir, "dec26.note"), Line: 2, Bullet: BulletTask},
+	}
+
+	if len(occurrences) != len(expectedOccurrences) {
+		t.Fatalf("Unexpected task history: %v", occurrences)
+	}
+
+	for i, expectedOccurrence := range expectedOccurrences {
+		expectedOccurrence.Title = callBankNote.Title
+		if occurrences[i] != expectedOccurrence {
+			t.Fatalf("Unexpected task occurrence: %s", occurrences[i])
+		}
+	}
+}
+
+func TestRunDailyMigrationAnnotatesProvenance(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	if err := os.WriteFile(filepath.Join(notesRootDir, "bujo.json"), []byte(`{"task_ids": true, "provenance": true}`), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	if err := os.MkdirAll(notesDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(notesDir, "dec21.note"), []byte("* call bank ^k3f9\n- note\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t).AddDate(0, 0, 1), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	expectedContents := map[string]string{
+		"dec21.note": "> call bank → dec25 ^k3f9\n- note\n",
+		"dec25.note": "> call bank ← dec21 → dec26 ^k3f9\n",
+		"dec26.note": "* call bank ← dec25 ^k3f9\n",
+	}
+
+	for fileName, expectedFileContents := range expectedContents {
+		fileContents, err := os.ReadFile(filepath.Join(notesDir, fileName))
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+
+		if string(fileContents) != expectedFileContents {
+			t.Fatalf("Unexpected contents in %s: %q", fileName, fileContents)
+		}
+	}
+}
+
+func writeStaleTestNotes(t *testing.T, config string) (string, string) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	if err := os.WriteFile(filepath.Join(notesRootDir, "bujo.json"), []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	if err := os.MkdirAll(notesDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	noteFiles := map[string]string{
+		"dec21.note": "> call bank\n> renew passport\n",
+		"dec22.note": "> call bank ← dec21\n",
+		"dec23.note": "> call bank ← dec22\n* water plants\n",
+		"dec24.note": "* call bank ← dec23\n* renew passport\n",
+	}
+
+	for fileName, fileContents := range noteFiles {
+		if err := os.WriteFile(filepath.Join(notesDir, fileName), []byte(fileContents), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	return notesRootDir, notesDir
+}
+
+func TestStaleTasks(t *testing.T) {
+	notesRootDir, notesDir := writeStaleTestNotes(t, `{}`)
+
+	journal, err := OpenJournal(notesRootDir)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+
+	staleTasks, err := journal.StaleTasks(0)
+	if err != nil {
+		t.Fatalf("Failed to find stale tasks: %v", err)
+	}
+
+	if len(staleTasks) != 1 || staleTasks[0].String() != filepath.Join(notesDir, "dec24.note") + ":1: * call bank ← dec23 (migrated 3 times)" {
+		t.Fatalf("Unexpected stale tasks: %v", staleTasks)
+	}
+
+	if staleTasks, err = journal.StaleTasks(1); err != nil {
+		t.Fatalf("Failed to find stale tasks: %v", err)
+	}
+
+	if len(staleTasks) != 2 || staleTasks[1].Title != "renew passport" || staleTasks[1].Migrations != 1 {
+		t.Fatalf("Unexpected stale tasks: %v", staleTasks)
+	}
+}
+
+func TestStaleTasksStartOverWhenTaskIsClosed(t *testing.T) {
+	notesRootDir, notesDir := writeStaleTestNotes(t, `{}`)
+
+	noteFiles := map[string]string{
+		"dec18.note": "> pay rent\n",
+		"dec19.note": "> pay rent\n",
+		"dec20.note": "x pay rent\n",
+		"dec22.note": "> pay rent\n> call bank\n",
+	}
+
+	for fileName, fileContents := range noteFiles {
+		if err := os.WriteFile(filepath.Join(notesDir, fileName), []byte(fileContents), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(notesDir, "dec24.note"), []byte("* call bank ← dec23\n* pay rent\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	journal, err := OpenJournal(notesRootDir)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+
+	staleTasks, err := journal.StaleTasks(1)
+	if err != nil {
+		t.Fatalf("Failed to find stale tasks: %v", err)
+	}
+
+	if len(staleTasks) != 2 || staleTasks[0].Migrations != 3 || staleTasks[1].Title != "pay rent" || staleTasks[1].Migrations != 1 {
+		t.Fatalf("Unexpected stale tasks: %v", staleTasks)
+	}
+}
+
+func TestStaleTasksFollowTaskListsInJournalOrder(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	// The task list for November comes before the days of December, so the task is closed after it was migrated
+	noteFiles := map[string]string{
+		filepath.Join("2019", "nov", "tasks.note"): "> a\n",
+		filepath.Join("2019", "dec", "dec3.note"): "x a\n",
+		filepath.Join("2020", "jan", "jan2.note"): "* a\n",
+	}
+	for path, contents := range noteFiles {
+		noteFilePath := filepath.Join(notesRootDir, path)
+		if err := os.MkdirAll(filepath.Dir(noteFilePath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(noteFilePath, []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	staleTasks, err := StaleTasks(notesRootDir, 1)
+	if err != nil {
+		t.Fatalf("Failed to find stale tasks: %v", err)
+	}
+
+	if len(staleTasks) != 0 {
+		t.Fatalf("Unexpected stale tasks: %v", staleTasks)
+	}
+}
+
+func TestRunDailyMigrationKeepsStaleCountsWhenAssigningTaskIDs(t *testing.T) {
+	notesRootDir, notesDir := writeStaleTestNotes(t, `{"stale_action": "flag", "task_ids": true}`)
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	fileContents, err := os.ReadFile(filepath.Join(notesDir, "dec25.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	if !strings.Contains(string(fileContents), "#stale") {
+		t.Fatalf("Stale task was not flagged: %q", fileContents)
+	}
+
+	// bujo stale agrees with the migration, even though the task only has an ID from this migration on
+	journal, err := OpenJournal(notesRootDir)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+
+	staleTasks, err := journal.StaleTasks(0)
+	if err != nil {
+		t.Fatalf("Failed to find stale tasks: %v", err)
+	}
+
+	if len(staleTasks) != 1 || !strings.HasPrefix(staleTasks[0].Title, "call bank") || staleTasks[0].Migrations != 4 {
+		t.Fatalf("Unexpected stale tasks: %v", staleTasks)
+	}
+}
+
+func TestRunDailyMigrationHandlesStaleTasks(t *testing.T) {
+	expectedContents := map[string][2]string{
+		StaleActionCancel: {"~ call bank ← dec23\n> renew passport\n", "* water plants\n* renew passport\n"},
+		StaleActionFlag: {"> call bank ← dec23\n> renew passport\n", "* water plants\n* call bank ← dec23 #stale\n* renew passport\n"},
+	}
+
+	for staleAction, expectedFileContents := range expectedContents {
+		notesRootDir, notesDir := writeStaleTestNotes(t, `{"stale_action": "` + staleAction + `"}`)
+
+		if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); err != nil {
+			t.Fatalf("Failed to run daily migration: %v", err)
+		}
+
+		for i, fileName := range []string{"dec24.note", "dec25.note"} {
+			fileContents, err := os.ReadFile(filepath.Join(notesDir, fileName))
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+
+			if string(fileContents) != expectedFileContents[i] {
+				t.Fatalf("Unexpected contents in %s with stale action %s: %q", fileName, staleAction, fileContents)
+			}
+		}
+	}
+}
+
+func TestRunDailyMigrationWithReview(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	if err := os.MkdirAll(notesDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(notesDir, "dec24.note"), []byte("- errands\n  * call bank\n  * buy stamps\n* wrap presents\n* book flights\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	var out bytes.Buffer
+	options := MigrationOptions{Reviewer: NewPromptReviewer(strings.NewReader(">\nc\nmaybe\n~\n<\n"), &out)}
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), options); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	dec24Path := filepath.Join(notesDir, "dec24.note")
+	prompt := "[>] migrate, [x] complete, [~] cancel or [<] schedule? "
+	expectedOutput := dec24Path + ":2\n- errands\n  * call bank\n" + prompt +
+		dec24Path + ":3\n- errands\n  * buy stamps\n" + prompt +
+		dec24Path + ":4\n* wrap presents\n" + prompt + "Unknown answer \"maybe\", answer >, x, ~ or <\n" + prompt +
+		dec24Path + ":5\n* book flights\n" + prompt
+	if out.String() != expectedOutput {
+		t.Fatalf("Unexpected output: %q", out.String())
+	}
+
+	sourceContents, err := os.ReadFile(dec24Path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(sourceContents) != "- errands\n  > call bank\n  x buy stamps\n~ wrap presents\n< book flights\n" {
+		t.Fatalf("Unexpected source file contents: %q", sourceContents)
+	}
+
+	newContents, err := os.ReadFile(filepath.Join(notesDir, "dec25.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(newContents) != "- errands\n  * call bank\n" {
+		t.Fatalf("Unexpected new file contents: %q", newContents)
+	}
+}
+
+func TestRunDailyMigrationWithReviewOnlyCopiesMigratedTasks(t *testing.T) {
+	answers := map[string][2]string{
+		">": {"> plan trip\n  > book flights\n    - window seat\n", "* plan trip\n  * book flights\n    - window seat\n"},
+		"x": {"> plan trip\n  x book flights\n    - window seat\n", "* plan trip\n"},
+		"~": {"> plan trip\n  ~ book flights\n    - window seat\n", "* plan trip\n"},
+		"<": {"> plan trip\n  < book flights\n    - window seat\n", "* plan trip\n"},
+	}
+
+	for answer, expectedFileContents := range answers {
+		notesRootDir := tempNotesDir(t)
+		t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+		notesDir := filepath.Join(notesRootDir, "2019", "dec")
+		if err := os.MkdirAll(notesDir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+
+		if err := os.WriteFile(filepath.Join(notesDir, "dec24.note"), []byte("* plan trip\n  * book flights\n    - window seat\n"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		// The parent task is migrated, and the answer is for the task under it
+		options := MigrationOptions{Reviewer: NewPromptReviewer(strings.NewReader("m\n" + answer + "\n"), io.Discard)}
+		if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), options); err != nil {
+			t.Fatalf("Failed to run daily migration: %v", err)
+		}
+
+		for i, fileName := range []string{"dec24.note", "dec25.note"} {
+			fileContents, err := os.ReadFile(filepath.Join(notesDir, fileName))
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+
+			if string(fileContents) != expectedFileContents[i] {
+				t.Fatalf("Unexpected contents in %s with answer %s: %q", fileName, answer, fileContents)
+			}
+		}
+	}
+}
+
+func TestRunDailyMigrationWithReviewClosesTasksUnderClosedTasks(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	if err := os.MkdirAll(notesDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(notesDir, "dec24.note"), []byte("* plan trip\n  * book flights\n* call bank\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	var out bytes.Buffer
+	options := MigrationOptions{Reviewer: NewPromptReviewer(strings.NewReader("~\nm\n"), &out)}
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), options); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	if strings.Contains(out.String(), "book flights") {
+		t.Fatalf("Task under cancelled task was reviewed: %q", out.String())
+	}
+
+	sourceContents, err := os.ReadFile(filepath.Join(notesDir, "dec24.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(sourceContents) != "~ plan trip\n  ~ book flights\n> call bank\n" {
+		t.Fatalf("Unexpected source file contents: %q", sourceContents)
+	}
+
+	newContents, err := os.ReadFile(filepath.Join(notesDir, "dec25.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(newContents) != "* call bank\n" {
+		t.Fatalf("Unexpected new file contents: %q", newContents)
+	}
+}
+
+func TestRunDailyMigrationWithReviewDoesNothingIfInputEnds(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	copyDir(t, "./test/dec", notesDir)
+
+	options := MigrationOptions{Reviewer: NewPromptReviewer(strings.NewReader("m\nc\n"), io.Discard)}
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), options); !errors.Is(err, errReviewEnded) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !testFilesEqual(t, "./test/dec", notesDir) {
+		t.Fatal("Note files were changed")
+	}
+}
+
+func TestParseNoteFile(t *testing.T) {
+	tests := []struct {
+		layout Layout
+		path string
+		kind NoteFileKind
+		date time.Time
+	}{
+		{bujoLayout{}, filepath.Join("2019", "dec", "dec21.note"), NoteFileDay, time.Date(2019, time.December, 21, 0, 0, 0, 0, time.UTC)},
+		{bujoLayout{}, filepath.Join("2020", "feb", "feb29.note"), NoteFileDay, time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{bujoLayout{}, filepath.Join("2019", "feb", "feb29.note"), NoteFileOther, time.Time{}},
+		{bujoLayout{}, filepath.Join("2019", "dec", "dec01.note"), NoteFileDay, time.Date(2019, time.December, 1, 0, 0, 0, 0, time.UTC)},
+		{bujoLayout{}, filepath.Join("2019", "dec", "tasks.note"), NoteFileTasks, time.Date(2019, time.December, 1, 0, 0, 0, 0, time.UTC)},
+		{bujoLayout{}, filepath.Join("2019", "dec", "foo21.note"), NoteFileOther, time.Time{}},
+		{bujoLayout{}, filepath.Join("2019", "dec", "nov21.note"), NoteFileOther, time.Time{}},
+		{bujoLayout{}, filepath.Join("dec", "dec21.note"), NoteFileOther, time.Time{}},
+		{isoLayout{}, filepath.Join("2019", "12", "2019-12-21.note"), NoteFileDay, time.Date(2019, time.December, 21, 0, 0, 0, 0, time.UTC)},
+		{isoLayout{}, filepath.Join("2019", "12", "tasks.note"), NoteFileTasks, time.Date(2019, time.December, 1, 0, 0, 0, 0, time.UTC)},
+		{isoLayout{}, filepath.Join("2019", "11", "2019-12-21.note"), NoteFileOther, time.Time{}},
+		{flatLayout{}, "2019-12-21.note", NoteFileDay, time.Date(2019, time.December, 21, 0, 0, 0, 0, time.UTC)},
+		{flatLayout{}, "2019-12-tasks.note", NoteFileTasks, time.Date(2019, time.December, 1, 0, 0, 0, 0, time.UTC)},
+		{flatLayout{}, "ideas.note", NoteFileOther, time.Time{}},
+		{bujoLayout{}, filepath.Join("2020", "jan", "week01.note"), NoteFileWeek, time.Date(2019, time.December, 30, 0, 0, 0, 0, time.UTC)},
+		{bujoLayout{}, filepath.Join("2019", "dec", "week01.note"), NoteFileOther, time.Time{}},
+		{bujoLayout{}, filepath.Join("2019", "dec", "week52.note"), NoteFileWeek, time.Date(2019, time.December, 23, 0, 0, 0, 0, time.UTC)},
+		{bujoLayout{}, filepath.Join("2019", "dec", "week53.note"), NoteFileOther, time.Time{}},
+		{isoLayout{}, filepath.Join("2020", "01", "2020-W01.note"), NoteFileWeek, time.Date(2019, time.December, 30, 0, 0, 0, 0, time.UTC)},
+		{flatLayout{}, "2020-W53.note", NoteFileWeek, time.Date(2020, time.December, 28, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		noteFile := test.layout.ParseNoteFile(test.path)
+		if noteFile.Kind != test.kind || !noteFile.Date.Equal(test.date) {
+			t.Fatalf("Unexpected date for %s: %v (kind: %d)", test.path, noteFile.Date, noteFile.Kind)
+		}
+
+		if weekFile := test.layout.WeekFile(test.date); test.kind == NoteFileWeek && weekFile != test.path {
+			t.Fatalf("Unexpected path for week of %v: %s", test.date, weekFile)
+		}
+
+		if dayFile := test.layout.DayFile(test.date); test.kind == NoteFileDay && !test.layout.ParseNoteFile(dayFile).Date.Equal(test.date) {
+			t.Fatalf("Unexpected date for %s: %v", dayFile, test.layout.ParseNoteFile(dayFile).Date)
+		}
+	}
+}
+
+func TestRunMigrationsWithLayouts(t *testing.T) {
+	tests := []struct {
+		layout string
+		previousDayFile string
+		dayFile string
+		tasksFile string
+	}{
+		{LayoutBujo, filepath.Join("2019", "dec", "dec31.note"), filepath.Join("2020", "jan", "jan1.note"), filepath.Join("2020", "jan", "tasks.note")},
+		{LayoutISO, filepath.Join("2019", "12", "2019-12-31.note"), filepath.Join("2020", "01", "2020-01-01.note"), filepath.Join("2020", "01", "tasks.note")},
+		{LayoutFlat, "2019-12-31.note", "2020-01-01.note", "2020-01-tasks.note"},
+	}
+
+	for _, test := range tests {
+		notesRootDir := tempNotesDir(t)
+		t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+		if err := os.WriteFile(filepath.Join(notesRootDir, journalConfigFile), []byte(fmt.Sprintf(`{"layout": %q}`, test.layout)), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		previousDayFilePath := filepath.Join(notesRootDir, test.previousDayFile)
+		if err := os.MkdirAll(filepath.Dir(previousDayFilePath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(previousDayFilePath, []byte("* call bank\nx buy stamps\n* wrap presents\n"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		if err := runMonthlyMigration(notesRootDir, monthlyMigrationTime(t), MigrationOptions{Match: "bank"}); err != nil {
+			t.Fatalf("Failed to run monthly migration with %s layout: %v", test.layout, err)
+		}
+
+		if err := runDailyMigration(notesRootDir, monthlyMigrationTime(t), MigrationOptions{}); err != nil {
+			t.Fatalf("Failed to run daily migration with %s layout: %v", test.layout, err)
+		}
+
+		for path, expectedContents := range map[string]string{
+			test.previousDayFile: "> call bank\nx buy stamps\n> wrap presents\n",
+			test.tasksFile: "* call bank\n",
+			test.dayFile: "* wrap presents\n",
+		} {
+			contents, err := os.ReadFile(filepath.Join(notesRootDir, path))
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(contents) != expectedContents {
+				t.Fatalf("Unexpected contents of %s with %s layout: %q", path, test.layout, contents)
+			}
+		}
+	}
+}
+
+func TestLoadConfigRejectsUnknownLayout(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	if err := os.WriteFile(filepath.Join(notesRootDir, journalConfigFile), []byte(`{"layout": "weekly"}`), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if _, err := LoadConfig(notesRootDir); err == nil {
+		t.Fatal("Expected an error for an unknown layout")
+	}
+}
+
+func TestRunDailyMigrationMergesFilesInChronologicalOrder(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	if err := os.MkdirAll(notesDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	for _, day := range []int{10, 2, 11, 3} {
+		if err := os.WriteFile(filepath.Join(notesDir, fmt.Sprintf("dec%d.note", day)), []byte(fmt.Sprintf("* task from dec%d\n", day)), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	contents, err := os.ReadFile(filepath.Join(notesDir, "dec25.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	expectedContents := "* task from dec2\n* task from dec3\n* task from dec10\n* task from dec11\n"
+	if string(contents) != expectedContents {
+		t.Fatalf("Unexpected new file contents: %q", contents)
+	}
+}
+
+func TestRunDailyMigrationMergesIntoExistingFile(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	if err := os.MkdirAll(notesDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(notesDir, "dec24.note"), []byte("- errands\n  * call bank\n  * buy stamps\n* wrap presents\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(notesDir, "dec25.note"), []byte("- morning notes\n  - snow\n- errands\n  * buy stamps\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	options := MigrationOptions{Merge: true}
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), options); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	expectedContents := "- morning notes\n  - snow\n- errands\n  * buy stamps\n  * call bank\n* wrap presents\n"
+	contents, err := os.ReadFile(filepath.Join(notesDir, "dec25.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(contents) != expectedContents {
+		t.Fatalf("Unexpected new file contents: %q", contents)
+	}
+
+	sourceContents, err := os.ReadFile(filepath.Join(notesDir, "dec24.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(sourceContents) != "- errands\n  > call bank\n  > buy stamps\n> wrap presents\n" {
+		t.Fatalf("Unexpected source file contents: %q", sourceContents)
+	}
+
+	// Reopening a task in the source file and migrating again doesn't copy it twice
+	if err := os.WriteFile(filepath.Join(notesDir, "dec24.note"), []byte("- errands\n  > call bank\n  * buy stamps\n> wrap presents\n* return library books\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), options); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	contents, err = os.ReadFile(filepath.Join(notesDir, "dec25.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(contents) != expectedContents + "* return library books\n" {
+		t.Fatalf("Unexpected new file contents: %q", contents)
+	}
+}
+
+func TestRunDailyMigrationMergesTasksThatAreClosedInExistingFile(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	if err := os.MkdirAll(notesDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(notesDir, "dec24.note"), []byte("* call bob\n* water plants\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(notesDir, "dec25.note"), []byte("x call bob\n- water plants\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{Merge: true}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	// Only open tasks count as already being in the new note file, so closed tasks and notes with the same title don't hide a task
+	contents, err := os.ReadFile(filepath.Join(notesDir, "dec25.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(contents) != "x call bob\n- water plants\n* call bob\n* water plants\n" {
+		t.Fatalf("Unexpected new file contents: %q", contents)
+	}
+
+	sourceContents, err := os.ReadFile(filepath.Join(notesDir, "dec24.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(sourceContents) != "> call bob\n> water plants\n" {
+		t.Fatalf("Unexpected source file contents: %q", sourceContents)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		oldText string
+		newText string
+		expectedDiff string
+	}{
+		{"* a\n", "* a\n", ""},
+		{"", "* a\n* b\n", "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+* a\n+* b\n"},
+		{"* a\n* b", "> a\n* b", "--- old\n+++ new\n@@ -1,2 +1,2 @@\n-* a\n+> a\n * b\n\\ No newline at end of file\n"},
+		{
+			"* 1\n- 2\n- 3\n- 4\n- 5\n- 6\n- 7\n- 8\n- 9\n* 10\n",
+			"> 1\n- 2\n- 3\n- 4\n- 5\n- 6\n- 7\n- 8\n- 9\n> 10\n",
+			"--- old\n+++ new\n@@ -1,4 +1,4 @@\n-* 1\n+> 1\n - 2\n - 3\n - 4\n@@ -7,4 +7,4 @@\n - 7\n - 8\n - 9\n-* 10\n+> 10\n",
+		},
+	}
+
+	for _, test := range tests {
+		if diff := unifiedDiff("old", "new", test.oldText, test.newText); diff != test.expectedDiff {
+			t.Fatalf("Unexpected diff from %q to %q: %q", test.oldText, test.newText, diff)
+		}
+	}
+}
+
+func TestDiffLinesOfLargeFiles(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 0; i < 5000; i++ {
+		oldLines = append(oldLines, fmt.Sprintf("* task %d\n", i))
+		if i % 1000 == 500 {
+			newLines = append(newLines, fmt.Sprintf("> task %d\n", i))
+		} else {
+			newLines = append(newLines, fmt.Sprintf("* task %d\n", i))
+		}
+	}
+
+	var removed, added int
+	var diffOldLines, diffNewLines []string
+	for _, line := range diffLines(oldLines, newLines) {
+		if line.kind != '+' {
+			diffOldLines = append(diffOldLines, line.text)
+		}
+		if line.kind != '-' {
+			diffNewLines = append(diffNewLines, line.text)
+		}
+
+		if line.kind == '-' {
+			removed++
+		} else if line.kind == '+' {
+			added++
+		}
+	}
+
+	if removed != 5 || added != 5 {
+		t.Fatalf("Unexpected number of changed lines: -%d +%d", removed, added)
+	}
+
+	if !slices.Equal(diffOldLines, oldLines) || !slices.Equal(diffNewLines, newLines) {
+		t.Fatal("Diff does not reproduce the old and new lines")
+	}
+}
+
+func TestRunDailyMigrationDryRun(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	if err := os.MkdirAll(notesDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(notesDir, "dec24.note"), []byte("- errands\n  * call bank\n  x buy stamps\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{DryRun: true, Out: &out}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	expectedDiff := "--- /dev/null\n+++ b/2019/dec/dec25.note\n@@ -0,0 +1,2 @@\n+- errands\n+  * call bank\n" +
+		"--- a/2019/dec/dec24.note\n+++ b/2019/dec/dec24.note\n@@ -1,3 +1,3 @@\n - errands\n-  * call bank\n+  > call bank\n   x buy stamps\n"
+	if out.String() != expectedDiff {
+		t.Fatalf("Unexpected diff: %q", out.String())
+	}
+
+	out.Reset()
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{DryRun: true, JSON: true, Out: &out}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	var changes []struct {
+		Path string `json:"path"`
+		Before string `json:"before"`
+		After string `json:"after"`
+		Created bool `json:"created"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &changes); err != nil {
+		t.Fatalf("Failed to parse changes: %v", err)
+	}
+	if len(changes) != 2 || !changes[0].Created || changes[0].After != "- errands\n  * call bank\n" || changes[1].After != "- errands\n  > call bank\n  x buy stamps\n" {
+		t.Fatalf("Unexpected changes: %+v", changes)
+	}
+	if changes[0].Path != "2019/dec/dec25.note" || changes[1].Path != "2019/dec/dec24.note" {
+		t.Fatalf("Unexpected change paths: %s, %s", changes[0].Path, changes[1].Path)
+	}
+
+	if _, err := os.Stat(filepath.Join(notesDir, "dec25.note")); !os.IsNotExist(err) {
+		t.Fatalf("New note file was created: %v", err)
+	}
+
+	contents, err := os.ReadFile(filepath.Join(notesDir, "dec24.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(contents) != "- errands\n  * call bank\n  x buy stamps\n" {
+		t.Fatalf("Source file was changed: %q", contents)
+	}
+}
+
+func TestRunDailyMigrationFinishesInterruptedMigration(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	copyDir(t, "./test/dec", notesDir)
+
+	// Crash after the first note file is replaced
+	renameCount := 0
+	renameFile = func(oldPath, newPath string) error {
+		renameCount++
+		if renameCount > 1 {
+			return errors.New("crash")
+		}
+
+		return os.Rename(oldPath, newPath)
+	}
+	defer func() { renameFile = os.Rename }()
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); err == nil {
+		t.Fatal("Expected migration to fail")
+	}
+
+	if _, err := os.Stat(filepath.Join(notesRootDir, stateDir, transactionFile)); err != nil {
+		t.Fatalf("Expected transaction to be recorded: %v", err)
+	}
+
+	renameFile = os.Rename
+
+	// A dry run can't show the changes until the interrupted migration is finished
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{DryRun: true, Out: io.Discard}); !errors.Is(err, errMigrationInterrupted) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The next migration finishes the interrupted one, then finds that the new note file already exists
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); !errors.Is(err, errNextNoteFileExists) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !testFilesEqual(t, "./test/expected-dec", notesDir) {
+		t.Fatal("Migrated files do not match expected files")
+	}
+
+	if _, err := os.Stat(filepath.Join(notesRootDir, stateDir, transactionFile)); !os.IsNotExist(err) {
+		t.Fatalf("Expected transaction to be removed: %v", err)
+	}
+}
+
+func TestRunDailyMigrationRemovesFilesStagedBeforeCrash(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	copyDir(t, "./test/dec", notesDir)
+
+	// A migration that crashed before recording its transaction leaves only staged files behind
+	if err := os.WriteFile(filepath.Join(notesDir, ".dec21.note.123" + stagedFileSuffix), []byte("> half written"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	if !testFilesEqual(t, "./test/expected-dec", notesDir) {
+		t.Fatal("Migrated files do not match expected files")
+	}
+}
+
+func TestUndo(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	copyDir(t, "./test/dec", notesDir)
+
+	journal, err := OpenJournal(notesRootDir)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+
+	if err := journal.Undo(false); !errors.Is(err, errNothingToUndo) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	if err := journal.Undo(false); err != nil {
+		t.Fatalf("Failed to undo migration: %v", err)
+	}
+
+	if !testFilesEqual(t, "./test/dec", notesDir) {
+		t.Fatal("Restored files do not match original files")
+	}
+
+	// The copies of the original files are removed with the snapshot
+	backups, err := os.ReadDir(filepath.Join(notesRootDir, stateDir, undoBackupDir))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Failed to read backup directory: %v", err)
+	}
+	for _, backup := range backups {
+		t.Errorf("Unexpected backup left after undo: %s", backup.Name())
+	}
+
+	if err := journal.Undo(false); !errors.Is(err, errNothingToUndo) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestUndoRefusesIfFilesWereEdited(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	copyDir(t, "./test/dec", notesDir)
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	newNoteFilePath := filepath.Join(notesDir, "dec25.note")
+	file, err := os.OpenFile(newNoteFilePath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	if _, err := file.WriteString("- a new note\n"); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	file.Close()
+
+	journal, err := OpenJournal(notesRootDir)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+
+	if err := journal.Undo(false); !errors.Is(err, errEditedSinceMigration) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The files are left as they were
+	sourceContents, err := os.ReadFile(filepath.Join(notesDir, "dec21.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	expectedSourceContents, err := os.ReadFile(filepath.Join("./test/expected-dec", "dec21.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(sourceContents) != string(expectedSourceContents) {
+		t.Fatalf("Source file was changed: %q", sourceContents)
+	}
+
+	if _, err := os.Stat(newNoteFilePath); err != nil {
+		t.Fatalf("New note file was removed: %v", err)
+	}
+}
+
+func TestUndoIgnoresEditsToFilesMigrationLeftUnchanged(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	copyDir(t, "./test/dec", notesDir)
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	// dec02.note has no open tasks, so the migration doesn't rewrite it
+	unchangedFilePath := filepath.Join(notesDir, "dec02.note")
+	file, err := os.OpenFile(unchangedFilePath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	if _, err := file.WriteString("- a new note\n"); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	file.Close()
+
+	editedContents, err := os.ReadFile(unchangedFilePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	if err := Undo(notesRootDir, false); err != nil {
+		t.Fatalf("Failed to undo migration: %v", err)
+	}
+
+	contents, err := os.ReadFile(unchangedFilePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(contents) != string(editedContents) {
+		t.Fatalf("Unexpected contents in unchanged file: %q", contents)
+	}
+
+	// The files the migration did change are restored
+	restoredContents, err := os.ReadFile(filepath.Join(notesDir, "dec21.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	originalContents, err := os.ReadFile(filepath.Join("./test/dec", "dec21.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(restoredContents) != string(originalContents) {
+		t.Fatalf("Unexpected restored contents: %q", restoredContents)
+	}
+
+	if _, err := os.Stat(filepath.Join(notesDir, "dec25.note")); !os.IsNotExist(err) {
+		t.Fatalf("Created file was not removed: %v", err)
+	}
+}
+
+func TestUndoRemovesCreatedDirectories(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	copyDir(t, "./test/dec", filepath.Join(notesRootDir, "2019", "dec"))
+
+	if err := runMonthlyMigration(notesRootDir, monthlyMigrationTime(t), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run monthly migration: %v", err)
+	}
+
+	if err := Undo(notesRootDir, false); err != nil {
+		t.Fatalf("Failed to undo migration: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(notesRootDir, "2020")); !os.IsNotExist(err) {
+		t.Fatalf("Created directory was not removed: %v", err)
+	}
+
+	if !testFilesEqual(t, "./test/dec", filepath.Join(notesRootDir, "2019", "dec")) {
+		t.Fatal("Restored files do not match original files")
+	}
+}
+
+func TestRunDailyMigrationFailsOrWaitsIfJournalIsLocked(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	notesDir := filepath.Join(notesRootDir, "2019", "dec")
+	copyDir(t, "./test/dec", notesDir)
+
+	journal, err := OpenJournal(notesRootDir)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+
+	unlock, err := journal.lock(false)
+	if err != nil {
+		t.Fatalf("Failed to lock journal: %v", err)
+	}
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{}); !errors.Is(err, errJournalLocked) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !testFilesEqual(t, "./test/dec", notesDir) {
+		t.Fatal("Note files were changed")
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		unlock()
+	}()
+
+	if err := runDailyMigration(notesRootDir, dailyMigrationTime(t), MigrationOptions{Wait: true}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	if !testFilesEqual(t, "./test/expected-dec", notesDir) {
+		t.Fatal("Migrated files do not match expected files")
+	}
+}
+
+func TestResolveNotesRootDir(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv(rootEnvVar, "")
+
+	resolve := func(root string) string {
+		notesRootDir, err := ResolveNotesRootDir(root)
+		if err != nil {
+			t.Fatalf("Failed to resolve notes directory: %v", err)
+		}
+
+		return notesRootDir
+	}
+
+	if notesRootDir := resolve(""); notesRootDir != defaultNotesRootDir {
+		t.Fatalf("Unexpected notes directory: %s", notesRootDir)
+	}
+
+	if err := os.MkdirAll(filepath.Join(configDir, "bujo"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, userConfigFile), []byte(`{"root": "/from/config"}`), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if notesRootDir := resolve(""); notesRootDir != "/from/config" {
+		t.Fatalf("Unexpected notes directory: %s", notesRootDir)
+	}
+
+	t.Setenv(rootEnvVar, "/from/env")
+	if notesRootDir := resolve(""); notesRootDir != "/from/env" {
+		t.Fatalf("Unexpected notes directory: %s", notesRootDir)
+	}
+
+	if notesRootDir := resolve("/from/flag"); notesRootDir != "/from/flag" {
+		t.Fatalf("Unexpected notes directory: %s", notesRootDir)
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatalf("Failed to find home directory: %v", err)
+	}
+	if notesRootDir := resolve("~/notes"); notesRootDir != filepath.Join(homeDir, "notes") {
+		t.Fatalf("Unexpected notes directory: %s", notesRootDir)
+	}
+}
+
+func TestRunWeeklyMigration(t *testing.T) {
+	notesRootDir := tempNotesDir(t)
+	t.Logf("Using temporary notes directory: %s", notesRootDir)
+
+	// The week before the week of January 6th 2020 is December 30th 2019 to January 5th 2020
+	noteFiles := map[string]string{
+		filepath.Join("2019", "dec", "dec29.note"): "* before the week\n",
+		filepath.Join("2019", "dec", "dec30.note"): "* dec30 task\n",
+		filepath.Join("2019", "dec", "dec31.note"): "- errands\n  * dec31 task\n  x done\n",
+		filepath.Join("2020", "jan", "jan2.note"): "* jan2 task\n",
+		filepath.Join("2020", "jan", "jan6.note"): "* after the week\n",
+		filepath.Join("2020", "jan", "week01.note"): "* week01 task\n",
+	}
+	for path, contents := range noteFiles {
+		noteFilePath := filepath.Join(notesRootDir, path)
+		if err := os.MkdirAll(filepath.Dir(noteFilePath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(noteFilePath, []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	weeklyMigrationTime := time.Date(2020, time.January, 6, 9, 0, 0, 0, time.UTC)
+	if err := runWeeklyMigration(notesRootDir, weeklyMigrationTime, MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run weekly migration: %v", err)
+	}
+
+	// The week ends in January, so the weekly log goes in January as well
+	expectedNoteFiles := map[string]string{
+		filepath.Join("2019", "dec", "dec29.note"): "* before the week\n",
+		filepath.Join("2019", "dec", "dec30.note"): "> dec30 task\n",
+		filepath.Join("2019", "dec", "dec31.note"): "- errands\n  > dec31 task\n  x done\n",
+		filepath.Join("2020", "jan", "jan2.note"): "> jan2 task\n",
+		filepath.Join("2020", "jan", "jan6.note"): "* after the week\n",
+		filepath.Join("2020", "jan", "week01.note"): "> week01 task\n",
+		filepath.Join("2020", "jan", "week02.note"): "* week01 task\n* dec30 task\n- errands\n  * dec31 task\n* jan2 task\n",
+	}
+	for path, expectedContents := range expectedNoteFiles {
+		contents, err := os.ReadFile(filepath.Join(notesRootDir, path))
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		if string(contents) != expectedContents {
+			t.Fatalf("Unexpected contents of %s: %q", path, contents)
+		}
+	}
+
+	// Daily migrations don't treat the weekly log as a daily note file
+	if err := runDailyMigration(notesRootDir, weeklyMigrationTime.AddDate(0, 0, 1), MigrationOptions{}); err != nil {
+		t.Fatalf("Failed to run daily migration: %v", err)
+	}
+
+	contents, err := os.ReadFile(filepath.Join(notesRootDir, "2020", "jan", "jan7.note"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(contents) != "* after the week\n" {
+		t.Fatalf("Unexpected new file contents: %q", contents)
+	}
 }
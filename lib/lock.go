@@ -0,0 +1,32 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var lockFileName string = "lock"
+
+var errJournalLocked = errors.New("Journal is locked by another bujo command")
+
+func (j *Journal) lockFilePath() string {
+	return filepath.Join(j.RootDir, stateDir, lockFileName)
+}
+
+// Take the journal-wide lock, so that only one command changes the journal at a time
+// If another command has the lock, either wait for it or return errJournalLocked
+// The returned function releases the lock
+func (j *Journal) lock(wait bool) (func(), error) {
+	if err := os.MkdirAll(filepath.Join(j.RootDir, stateDir), 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create state directory: %w", err)
+	}
+
+	unlock, err := lockFile(j.lockFilePath(), wait)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to lock journal: %w", err)
+	}
+
+	return unlock, nil
+}
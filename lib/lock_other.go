@@ -0,0 +1,29 @@
+//go:build !unix
+
+package lib
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+var lockPollInterval time.Duration = 100 * time.Millisecond
+
+// Without flock, the lock is held by whoever creates the lock file
+// If bujo exits without releasing the lock, the lock file has to be removed by hand
+func lockFile(lockFilePath string, wait bool) (func(), error) {
+	for {
+		file, err := os.OpenFile(lockFilePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(lockFilePath) }, nil
+		} else if !os.IsExist(err) {
+			return nil, fmt.Errorf("Failed to create lock file: %w", err)
+		} else if !wait {
+			return nil, errJournalLocked
+		}
+
+		time.Sleep(lockPollInterval)
+	}
+}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// An flock on the lock file is released by the operating system if bujo exits without releasing it
+func lockFile(lockFilePath string, wait bool) (func(), error) {
+	file, err := os.OpenFile(lockFilePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open lock file: %w", err)
+	}
+
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+
+	for {
+		err = syscall.Flock(int(file.Fd()), how)
+		if !errors.Is(err, syscall.EINTR) {
+			break
+		}
+	}
+
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		file.Close()
+		return nil, errJournalLocked
+	} else if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Failed to lock file: %w", err)
+	}
+
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
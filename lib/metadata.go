@@ -0,0 +1,77 @@
+package lib
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Metadata is written inline in note titles, ex. "* fix login #backend @alice due:2020-01-10"
+// It is parsed into fields on the note, and the title itself is never changed
+var fieldRegexString string = "^([A-Za-z][\\w-]*):([^\\s/].*)$"
+var fieldRegex = regexp.MustCompile(fieldRegexString)
+
+func (n *Note) parseMetadata() {
+	n.ID = parseTaskID(n.Title)
+	n.MigratedTo = parseMarker(n.Title, migratedToMarker)
+	n.MigratedFrom = parseMarker(n.Title, migratedFromMarker)
+	n.Tags = nil
+	n.Mentions = nil
+	n.Fields = nil
+
+	for _, token := range(strings.Fields(n.Title)) {
+		if len(token) > 1 && token[0] == '#' {
+			n.Tags = append(n.Tags, token[1:])
+		} else if len(token) > 1 && token[0] == '@' {
+			n.Mentions = append(n.Mentions, token[1:])
+		} else if matches := fieldRegex.FindStringSubmatch(token); matches != nil {
+			if n.Fields == nil {
+				n.Fields = make(map[string]string)
+			}
+
+			n.Fields[matches[1]] = matches[2]
+		}
+	}
+}
+
+func (n Note) HasTag(tag string) bool {
+	for _, noteTag := range(n.Tags) {
+		if noteTag == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (n Note) HasMention(mention string) bool {
+	for _, noteMention := range(n.Mentions) {
+		if noteMention == mention {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check whether the note has all of the metadata in a query, ex. "#backend @alice due:2020-01-10"
+func (n Note) MatchesMetadata(query string) bool {
+	for _, token := range(strings.Fields(query)) {
+		if len(token) > 1 && token[0] == '#' {
+			if !n.HasTag(token[1:]) {
+				return false
+			}
+		} else if len(token) > 1 && token[0] == '@' {
+			if !n.HasMention(token[1:]) {
+				return false
+			}
+		} else if matches := fieldRegex.FindStringSubmatch(token); matches != nil {
+			if value, ok := n.Fields[matches[1]]; !ok || value != matches[2] {
+				return false
+			}
+		} else if !strings.Contains(n.Title, token) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"cmp"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+type NoteFileKind int
+
+const (
+	NoteFileOther NoteFileKind = iota
+	NoteFileDay
+	NoteFileTasks
+	NoteFileWeek
+)
+
+// A note file, and the day, week or month it is for, ex. "2019/dec/dec21.note", "2019/dec/week51.note" or "2019/dec/tasks.note"
+// Other files, like "2019/dec/ideas.note", aren't for a day, week or month
+type NoteFile struct {
+	Path string
+	Date time.Time // The day, the Monday of the week for a weekly log, or the first day of the month for a task list
+	Kind NoteFileKind
+}
+
+// Check whether the note file belongs to a month
+// Weekly logs belong to the month their week is filed under
+func (noteFile NoteFile) IsFor(month time.Time) bool {
+	switch noteFile.Kind {
+	case NoteFileOther:
+		return false
+	case NoteFileWeek:
+		return weekMonth(noteFile.Date).Equal(firstOfMonth(month))
+	}
+
+	return firstOfMonth(noteFile.Date).Equal(firstOfMonth(month))
+}
+
+// Daily note files come first, oldest first, followed by other files in order of their names
+func (noteFile NoteFile) compare(otherNoteFile NoteFile) int {
+	isDay := noteFile.Kind == NoteFileDay
+	otherIsDay := otherNoteFile.Kind == NoteFileDay
+	if isDay && !otherIsDay {
+		return -1
+	} else if otherIsDay && !isDay {
+		return 1
+	} else if isDay {
+		if c := noteFile.Date.Compare(otherNoteFile.Date); c != 0 {
+			return c
+		}
+	}
+
+	return cmp.Compare(noteFile.Path, otherNoteFile.Path)
+}
+
+// Find what a note file in the journal is for, using the journal's layout
+func (j *Journal) parseNoteFile(noteFilePath string) NoteFile {
+	relativePath, err := filepath.Rel(j.RootDir, noteFilePath)
+	if err != nil {
+		return NoteFile{Path: noteFilePath}
+	}
+
+	noteFile := j.layout.ParseNoteFile(relativePath)
+	noteFile.Path = noteFilePath
+
+	return noteFile
+}
+
+// Note files for a day, week or month come first, in the order they were written, so a task list or weekly log comes before the days of its month or week
+// Other files follow in order of their names
+func (noteFile NoteFile) compareDates(otherNoteFile NoteFile) int {
+	isOther := noteFile.Kind == NoteFileOther
+	otherIsOther := otherNoteFile.Kind == NoteFileOther
+	if isOther != otherIsOther {
+		if isOther {
+			return 1
+		}
+
+		return -1
+	} else if !isOther {
+		if c := noteFile.Date.Compare(otherNoteFile.Date); c != 0 {
+			return c
+		}
+
+		if c := cmp.Compare(noteFileKindOrder[noteFile.Kind], noteFileKindOrder[otherNoteFile.Kind]); c != 0 {
+			return c
+		}
+	}
+
+	return cmp.Compare(noteFile.Path, otherNoteFile.Path)
+}
+
+// Files for a longer period come first when they start on the same day
+var noteFileKindOrder = map[NoteFileKind]int{
+	NoteFileTasks: 0,
+	NoteFileWeek: 1,
+	NoteFileDay: 2,
+}
+
+func (j *Journal) sortNoteFilePathsByDate(noteFilePaths []string) {
+	slices.SortFunc(noteFilePaths, func(a, b string) int {
+		return j.parseNoteFile(a).compareDates(j.parseNoteFile(b))
+	})
+}
+
+func (j *Journal) sortNoteFilePaths(noteFilePaths []string) {
+	slices.SortFunc(noteFilePaths, func(a, b string) int {
+		return j.parseNoteFile(a).compare(j.parseNoteFile(b))
+	})
+}
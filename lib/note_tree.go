@@ -2,52 +2,166 @@ package lib
 
 import (
 	"fmt"
+	"io"
 	"regexp"
+	"slices"
 	"strings"
 )
 
-var leadingWhitespaceRegexString string = "^\\s*"
-var bulletRegexString string = "[?\\-*x~><]"
-var unmigratedBulletRegex string = "\\*"
+// A backslash before a bullet character at the start of a body line stops the line from being a bullet, and is removed from the body text
+var escapedLineRegexFormat string = "^(\\s*)\\\\(%s)"
 
+type Bullet rune
+
+const (
+	BulletNote Bullet = '-'
+	BulletQuestion Bullet = '?'
+	BulletTask Bullet = '*'
+	BulletDone Bullet = 'x'
+	BulletCancelled Bullet = '~'
+	BulletMigrated Bullet = '>'
+	BulletScheduled Bullet = '<'
+)
+
+func (b Bullet) Name() string {
+	if definition, ok := defaultVocabulary.Definition(b); ok {
+		return definition.Name
+	}
+
+	return "unknown"
+}
+
+func (b Bullet) String() string {
+	return string(b)
+}
+
+// Signifiers are written directly in front of a bullet to give it extra meaning
+type Signifier rune
+
+const (
+	SignifierPriority Signifier = '*'
+	SignifierInspiration Signifier = '!'
+	SignifierExplore Signifier = '?'
+)
+
+// A note is a single bullet line, split into its parts, followed by any continuation lines
+// Rendering the parts back in order reproduces the original text exactly
 type Note struct {
-	Text string
+	Indent string
+	Signifiers string
+	Bullet Bullet
+	Spacing string // Whitespace between the bullet and the title
+	Title string
+	Body []string
 	Depth int
+	Line int
+	ID string // "^id" at the end of the title, without the "^"
+	MigratedTo string // "→ name" in the title, without the "→"
+	MigratedFrom string // "← name" in the title, without the "←"
+	Tags []string // "#tag" in the title, without the "#"
+	Mentions []string // "@mention" in the title, without the "@"
+	Fields map[string]string // "key:value" in the title
 	ChildNotes NoteTree
+	vocabulary *Vocabulary // The bullets the note was parsed with, or nil for the default bullets
 }
 
+// Preamble holds any lines before the first bullet, and FinalNewline records whether the text ended with a newline
+// Both are only set on the top-level tree of a file, so that the file can be rendered back exactly
+// Diagnostics holds any problems found while parsing the file, and is also only set on the top-level tree
 type NoteTree struct {
+	Preamble []string
 	Notes []*Note
+	FinalNewline bool
+	Diagnostics ParseErrors
 }
 
-func (n *Note) AddText(text string) {
-	n.Text = n.Text + "\n" + text
+func (n *Note) AddBodyLine(line string) {
+	n.Body = append(n.Body, line)
 }
 
-func (n Note) IsUnmigrated() (bool, error) {
-	r, err := regexp.Compile(leadingWhitespaceRegexString + unmigratedBulletRegex)
+func (n Note) BodyText() (string, error) {
+	r, err := regexp.Compile(fmt.Sprintf(escapedLineRegexFormat, n.Vocabulary().bulletRegexString()))
 	if err != nil {
-		return false, fmt.Errorf("Failed to compile regex: %w", err)
+		return "", fmt.Errorf("Failed to compile regex: %w", err)
 	}
 
-	return r.MatchString(n.Text), nil
+	var fence codeFence
+	var lines []string
+	for i, line := range(n.Body) {
+		if fence.scan(line, i + 1) {
+			lines = append(lines, line)
+			continue
+		}
+
+		lines = append(lines, r.ReplaceAllString(line, "$1$2"))
+	}
+
+	return strings.Join(lines, "\n"), nil
 }
 
-func (n *Note) Migrate() error {
-	r, err := regexp.Compile(leadingWhitespaceRegexString + unmigratedBulletRegex)
-	if err != nil {
-		return fmt.Errorf("Failed to compile regex: %w", err)
+func (n Note) Vocabulary() *Vocabulary {
+	if n.vocabulary == nil {
+		return defaultVocabulary
 	}
 
-	leadingBulletText := r.FindString(n.Text)
-	newLeadingBulletText := leadingBulletText[:len(leadingBulletText)-1] + ">" // Change the bullet from "*" to ">"
-	n.Text = strings.Replace(n.Text, leadingBulletText, newLeadingBulletText, 1)
+	return n.vocabulary
+}
 
-	return nil
+func (n Note) definition() BulletDefinition {
+	definition, _ := n.Vocabulary().Definition(n.Bullet)
+	return definition
+}
+
+func (n Note) BulletName() string {
+	return n.definition().Name
+}
+
+func (n Note) IsOpen() bool {
+	return n.definition().Open
+}
+
+// Check whether the note is open, and should be carried forward by a migration
+func (n Note) IsUnmigrated() bool {
+	definition := n.definition()
+	return definition.Open && definition.CarryForward
+}
+
+func (n *Note) Migrate() {
+	if migratesTo := n.definition().MigratesTo; migratesTo != "" {
+		n.Bullet = bulletOf(migratesTo)
+	}
+}
+
+// Take a task out of a migration by giving it a closed bullet, along with the tasks under it that would have been migrated
+func (n *Note) withdraw(bullet Bullet, isMigrationCandidate func(*Note) bool) {
+	n.ChildNotes.Walk(func(note *Note) {
+		if isMigrationCandidate(note) {
+			note.Bullet = bullet
+		}
+	})
+	n.Bullet = bullet
+}
+
+func (n Note) HasSignifier(signifier Signifier) bool {
+	return strings.ContainsRune(n.Signifiers, rune(signifier))
+}
+
+// The first line of the note
+func (n Note) bulletLine() string {
+	return n.Indent + n.Signifiers + n.Bullet.String() + n.Spacing + n.Title
+}
+
+func (n Note) Text() string {
+	text := n.bulletLine()
+	for _, line := range(n.Body) {
+		text = text + "\n" + line
+	}
+
+	return text
 }
 
 func (n Note) String() string {
-	noteString := n.Text
+	noteString := n.Text()
 	if n.ChildNotes.Length() > 0 {
 		return noteString + "\n" + n.ChildNotes.String()
 	}
@@ -62,179 +176,219 @@ func (noteTree *NoteTree) Add(n *Note) {
 func (noteTree NoteTree) Copy() NoteTree {
 	var notes []*Note
 	for _, existingNote := range(noteTree.Notes) {
-		newChildNotes := existingNote.ChildNotes.Copy()
-		notes = append(notes, &Note{Text: existingNote.Text, Depth: existingNote.Depth, ChildNotes: newChildNotes})
+		newNote := *existingNote
+		newNote.Body = append([]string(nil), existingNote.Body...)
+		newNote.parseMetadata()
+		newNote.ChildNotes = existingNote.ChildNotes.Copy()
+		notes = append(notes, &newNote)
 	}
 
-	return NoteTree{Notes: notes}
+	return NoteTree{Preamble: append([]string(nil), noteTree.Preamble...), Notes: notes, FinalNewline: noteTree.FinalNewline}
 }
 
-func (noteTree *NoteTree) FilterIncompleteTasks() error {
+// Keep only the notes that match, and the notes that contain them
+// The children of a matching note are kept as well
+func (noteTree *NoteTree) Filter(keep func(*Note) bool) {
 	if noteTree.Length() == 0 {
-		return nil
+		return
 	}
 
 	var newNotes []*Note
 	for _, note := range(noteTree.Notes) {
-		isUnmigrated, err := note.IsUnmigrated()
-		if err != nil {
-			return fmt.Errorf("Failed to check if note is unmigrated: %w", err)
-		}
-		if isUnmigrated {
+		if keep(note) {
 			newNotes = append(newNotes, note)
 			continue
 		}
 
-		if err := note.ChildNotes.FilterIncompleteTasks(); err != nil {
-			return fmt.Errorf("Failed to filter unmigrated child notes: %w", err)
-		}
+		note.ChildNotes.Filter(keep)
 		if note.ChildNotes.Length() > 0 {
 			newNotes = append(newNotes, note)
 		}
 	}
 
 	noteTree.Notes = newNotes
+}
 
-	return nil
+// Keep only the notes that match, and the notes that contain them
+// Unlike Filter, the children of a matching note are only kept if they match as well
+func (noteTree *NoteTree) Prune(keep func(*Note) bool) {
+	var newNotes []*Note
+	for _, note := range(noteTree.Notes) {
+		note.ChildNotes.Prune(keep)
+		if keep(note) || note.ChildNotes.Length() > 0 {
+			newNotes = append(newNotes, note)
+		}
+	}
+
+	noteTree.Notes = newNotes
 }
 
-func (noteTree NoteTree) Length() int {
-	return len(noteTree.Notes)
+// Find the lines of the notes that are selected, where each note is selected knowing whether its parent note was
+func (noteTree NoteTree) selectLines(selectNote func(note *Note, parentSelected bool) bool) map[int]bool {
+	selectedLines := make(map[int]bool)
+
+	var visit func(noteTree NoteTree, parentSelected bool)
+	visit = func(noteTree NoteTree, parentSelected bool) {
+		for _, note := range(noteTree.Notes) {
+			selected := selectNote(note, parentSelected)
+			if selected {
+				selectedLines[note.Line] = true
+			}
+
+			visit(note.ChildNotes, selected)
+		}
+	}
+	visit(noteTree, false)
+
+	return selectedLines
 }
 
-func (noteTree *NoteTree) Merge(otherNoteTree NoteTree) {
-	for _, note := range(otherNoteTree.Notes) {
-		noteTree.Notes = append(noteTree.Notes, note)
+func (noteTree *NoteTree) FilterIncompleteTasks() error {
+	noteTree.Filter(func(note *Note) bool { return note.IsUnmigrated() })
+
+	return nil
+}
+
+// Call visit for every note in the tree, parents before children
+func (noteTree NoteTree) Walk(visit func(*Note)) {
+	for _, note := range(noteTree.Notes) {
+		visit(note)
+		note.ChildNotes.Walk(visit)
 	}
 }
 
-func (noteTree NoteTree) MigrateAll() error {
+func (noteTree NoteTree) hasPriority() bool {
 	for _, note := range(noteTree.Notes) {
-		isUnmigrated, err := note.IsUnmigrated()
-		if err != nil {
-			return fmt.Errorf("Failed to check if note is unmigrated: %w", err)
-		}
-		if !isUnmigrated {
-			goto migrateChildNotes
-		}
-		if err := note.Migrate(); err != nil {
-			return fmt.Errorf("Failed to migrate note: %w", err)
+		if note.HasSignifier(SignifierPriority) || note.ChildNotes.hasPriority() {
+			return true
 		}
+	}
 
-	migrateChildNotes:
+	return false
+}
 
-		if err := note.ChildNotes.MigrateAll(); err != nil {
-			return fmt.Errorf("Failed to migrate child notes: %w", err)
+// Move notes marked as a priority, and the notes that contain them, in front of their siblings
+// The order of the notes is otherwise unchanged
+func (noteTree NoteTree) SortPriorityFirst() {
+	slices.SortStableFunc(noteTree.Notes, func(a, b *Note) int {
+		aIsPriority := a.HasSignifier(SignifierPriority) || a.ChildNotes.hasPriority()
+		bIsPriority := b.HasSignifier(SignifierPriority) || b.ChildNotes.hasPriority()
+		if aIsPriority && !bIsPriority {
+			return -1
+		} else if bIsPriority && !aIsPriority {
+			return 1
 		}
-	}
 
-	return nil
-}
+		return 0
+	})
 
-func (noteTree NoteTree) String() string {
-	var noteStrings []string
 	for _, note := range(noteTree.Notes) {
-		noteStrings = append(noteStrings, note.String())
+		note.ChildNotes.SortPriorityFirst()
 	}
+}
 
-	return strings.Join(noteStrings, "\n")
+func (noteTree NoteTree) Length() int {
+	return len(noteTree.Notes)
 }
 
-func lineDepth(line string) (int, error) {
-	r, err := regexp.Compile(leadingWhitespaceRegexString)
-	if err != nil {
-		return -1, fmt.Errorf("Failed to compile regex: %w", err)
+func (noteTree *NoteTree) Merge(otherNoteTree NoteTree) {
+	for _, note := range(otherNoteTree.Notes) {
+		noteTree.Notes = append(noteTree.Notes, note)
 	}
+}
 
-	matches := r.FindAllString(line, 1)
-	if len(matches) == 0 {
-		return 0, nil
-	}
+// Add notes that aren't already in the tree, without changing the notes that are
+// A note that is already in the tree only has its new child notes added, after its existing ones
+func (noteTree *NoteTree) mergeNew(otherNoteTree NoteTree) {
+	for _, note := range(otherNoteTree.Notes) {
+		existingIndex := slices.IndexFunc(noteTree.Notes, func(existingNote *Note) bool {
+			return existingNote.Signifiers == note.Signifiers && existingNote.Bullet == note.Bullet && existingNote.taskKey() == note.taskKey()
+		})
+		if existingIndex < 0 {
+			noteTree.Add(note)
+			continue
+		}
 
-	return len(matches[0]), nil
+		noteTree.Notes[existingIndex].ChildNotes.mergeNew(note.ChildNotes)
+	}
 }
 
-func parseNotes(text string) ([]*Note, error) {
-	lines := strings.Split(text, "\n")
+func (noteTree NoteTree) MigrateAll() error {
+	return noteTree.MigrateMatching(func(note *Note) bool { return true })
+}
 
-	var notes []*Note
-	var prevNote *Note // Advance declaration for goto
-	for _, line := range(lines) {
-		r, err := regexp.Compile(leadingWhitespaceRegexString + bulletRegexString)
-		if err != nil {
-			return notes, fmt.Errorf("Failed to compile regex: %w", err)
+// Migrate the unmigrated notes that match
+func (noteTree NoteTree) MigrateMatching(match func(*Note) bool) error {
+	for _, note := range(noteTree.Notes) {
+		if note.IsUnmigrated() && match(note) {
+			note.Migrate()
 		}
 
-		if r.MatchString(line) {
-			goto parseBulletNote
+		if err := note.ChildNotes.MigrateMatching(match); err != nil {
+			return fmt.Errorf("Failed to migrate child notes: %w", err)
 		}
+	}
 
-		// Append non-bullet notes to the previous note
-		if len(notes) == 0 {
-			continue // Skip non-bullet notes at the top of the file
-		}
-		prevNote = notes[len(notes)-1]
-		prevNote.AddText(line)
+	return nil
+}
 
-		continue
+func (noteTree NoteTree) String() string {
+	var builder strings.Builder
+	noteTree.WriteTo(&builder) // Writing to a strings.Builder never fails
 
-	parseBulletNote:
+	return builder.String()
+}
 
-		depth, err := lineDepth(line)
-		if err != nil {
-			return notes, fmt.Errorf("Failed to get line depth: %w", err)
-		}
+// Write lines separated by newlines, keeping the first error
+type lineWriter struct {
+	w io.Writer
+	written int64
+	lineCount int
+	err error
+}
 
-		notes = append(notes, &Note{Text: line, Depth: depth})
+func (lw *lineWriter) write(text string) {
+	if lw.err != nil {
+		return
 	}
 
-	return notes, nil
+	n, err := io.WriteString(lw.w, text)
+	lw.written += int64(n)
+	lw.err = err
 }
 
-// Note: Implementing this recursively results in a less readable implementation
-// You need to keep track of the current index in the notes array throughout the recursive calls
-// You can pass the index by reference, but it makes the code much more complicated
-func parseNoteTrees(notes []*Note) (NoteTree, error) {
-	var noteStack Stack
-
-	rootNote := Note{Depth: -1}
-	noteStack.Push(&rootNote)
+func (lw *lineWriter) writeLine(line string) {
+	if lw.lineCount > 0 {
+		lw.write("\n")
+	}
 
-	var currentDepth int
-	var prevNote *Note
-	for _, note := range(notes) {
-		parentNote := noteStack.Peek().(*Note)
+	lw.write(line)
+	lw.lineCount++
+}
 
-		if note.Depth < currentDepth {
-			// Pop parent notes until we reach the right depth
-			for parentNote.Depth >= note.Depth {
-				noteStack.Pop()
-				parentNote = noteStack.Peek().(*Note)
-			}
-		} else if note.Depth > currentDepth {
-			parentNote = prevNote
-			noteStack.Push(prevNote)
+func (lw *lineWriter) writeNotes(noteTree NoteTree) {
+	for _, note := range(noteTree.Notes) {
+		lw.writeLine(note.bulletLine())
+		for _, line := range(note.Body) {
+			lw.writeLine(line)
 		}
 
-		currentDepth = note.Depth
-		prevNote = note
-		parentNote.ChildNotes.Add(note)
+		lw.writeNotes(note.ChildNotes)
 	}
-
-	return rootNote.ChildNotes, nil
 }
 
-func ParseNoteTree(text string) (NoteTree, error) {
-	var noteTree NoteTree
-
-	notes, err := parseNotes(text)
-	if err != nil {
-		return noteTree, fmt.Errorf("Failed to parse notes: %w", err)
+// Write the note tree one line at a time, so that large note trees don't need to be rendered as a single string
+func (noteTree NoteTree) WriteTo(w io.Writer) (int64, error) {
+	lw := lineWriter{w: w}
+	for _, line := range(noteTree.Preamble) {
+		lw.writeLine(line)
 	}
 
-	if noteTree, err = parseNoteTrees(notes); err != nil {
-		return noteTree, fmt.Errorf("Failed to parse note trees: %w", err)
-	} else {
-		return noteTree, nil
+	lw.writeNotes(noteTree)
+
+	if noteTree.FinalNewline && (len(noteTree.Preamble) > 0 || len(noteTree.Notes) > 0) { // There is no line to end in a tree without any lines
+		lw.write("\n")
 	}
+
+	return lw.written, lw.err
 }
@@ -1,18 +1,28 @@
 package lib
 
-import "testing"
-
-func readNoteFile(t *testing.T) string {
-	noteFileText, err := readFileText("./test/test.note")
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func readTestNoteFile(t *testing.T) string {
+	noteFileBytes, err := os.ReadFile("./test/test.note")
 	if err != nil {
 		t.Fatalf("Failed to read note file: %v", err)
 	}
 
-	return noteFileText
+	return string(noteFileBytes)
 }
 
 func TestFilterIncompleteTasks(t *testing.T) {
-	noteFileText := readNoteFile(t)
+	noteFileText := readTestNoteFile(t)
 
 	noteTree, err := ParseNoteTree(noteFileText)
 	if err != nil {
@@ -27,11 +37,11 @@ func TestFilterIncompleteTasks(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[0].Text; noteText != "- Test 1\n\ncontent 1\n" {
+	if noteText := noteTree.Notes[0].Text(); noteText != "- Test 1\n\ncontent 1\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
-	if noteText := noteTree.Notes[1].Text; noteText != "- Test 2\n\ncontent 2\n" {
+	if noteText := noteTree.Notes[1].Text(); noteText != "- Test 2\n\ncontent 2\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
@@ -39,11 +49,11 @@ func TestFilterIncompleteTasks(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[0].ChildNotes.Notes[0].Text; noteText != "  - Test 1.1\n\ncontent 1.1\n" {
+	if noteText := noteTree.Notes[0].ChildNotes.Notes[0].Text(); noteText != "  - Test 1.1\n\ncontent 1.1\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
-	if noteText := noteTree.Notes[0].ChildNotes.Notes[1].Text; noteText != "  * Test 1.2\n\ncontent 1.2\n" {
+	if noteText := noteTree.Notes[0].ChildNotes.Notes[1].Text(); noteText != "  * Test 1.2\n\ncontent 1.2\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
@@ -51,7 +61,7 @@ func TestFilterIncompleteTasks(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[0].ChildNotes.Notes[0].ChildNotes.Notes[0].Text; noteText != "    * Test 1.1.1\n\ncontent 1.1.1\n" {
+	if noteText := noteTree.Notes[0].ChildNotes.Notes[0].ChildNotes.Notes[0].Text(); noteText != "    * Test 1.1.1\n\ncontent 1.1.1\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
@@ -59,7 +69,7 @@ func TestFilterIncompleteTasks(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].Text; noteText != " - Test 2.1\n\ncontent 2.1\n" {
+	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].Text(); noteText != " - Test 2.1\n\ncontent 2.1\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
@@ -67,13 +77,13 @@ func TestFilterIncompleteTasks(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].ChildNotes.Notes[0].Text; noteText != "  * Test 2.1.2\n\ncontent 2.1.2\n" {
+	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].ChildNotes.Notes[0].Text(); noteText != "  * Test 2.1.2\n\ncontent 2.1.2\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 }
 
 func TestMigrateAll(t *testing.T) {
-	noteFileText := readNoteFile(t)
+	noteFileText := readTestNoteFile(t)
 
 	noteTree, err := ParseNoteTree(noteFileText)
 	if err != nil {
@@ -88,15 +98,15 @@ func TestMigrateAll(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[0].Text; noteText != "- Test 1\n\ncontent 1\n" {
+	if noteText := noteTree.Notes[0].Text(); noteText != "- Test 1\n\ncontent 1\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
-	if noteText := noteTree.Notes[1].Text; noteText != "- Test 2\n\ncontent 2\n" {
+	if noteText := noteTree.Notes[1].Text(); noteText != "- Test 2\n\ncontent 2\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
-	if noteText := noteTree.Notes[2].Text; noteText != "- Test 3\n\ncontent 3\n" {
+	if noteText := noteTree.Notes[2].Text(); noteText != "- Test 3\n\ncontent 3\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
@@ -104,11 +114,11 @@ func TestMigrateAll(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[0].ChildNotes.Notes[0].Text; noteText != "  - Test 1.1\n\ncontent 1.1\n" {
+	if noteText := noteTree.Notes[0].ChildNotes.Notes[0].Text(); noteText != "  - Test 1.1\n\ncontent 1.1\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
-	if noteText := noteTree.Notes[0].ChildNotes.Notes[1].Text; noteText != "  > Test 1.2\n\ncontent 1.2\n" {
+	if noteText := noteTree.Notes[0].ChildNotes.Notes[1].Text(); noteText != "  > Test 1.2\n\ncontent 1.2\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
@@ -116,7 +126,7 @@ func TestMigrateAll(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[0].ChildNotes.Notes[0].ChildNotes.Notes[0].Text; noteText != "    > Test 1.1.1\n\ncontent 1.1.1\n" {
+	if noteText := noteTree.Notes[0].ChildNotes.Notes[0].ChildNotes.Notes[0].Text(); noteText != "    > Test 1.1.1\n\ncontent 1.1.1\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
@@ -124,7 +134,7 @@ func TestMigrateAll(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].Text; noteText != " - Test 2.1\n\ncontent 2.1\n" {
+	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].Text(); noteText != " - Test 2.1\n\ncontent 2.1\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
@@ -132,11 +142,11 @@ func TestMigrateAll(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].ChildNotes.Notes[0].Text; noteText != "  - Test 2.1.1\n\ncontent 2.1.1\n" {
+	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].ChildNotes.Notes[0].Text(); noteText != "  - Test 2.1.1\n\ncontent 2.1.1\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
-	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].ChildNotes.Notes[1].Text; noteText != "  > Test 2.1.2\n\ncontent 2.1.2\n" {
+	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].ChildNotes.Notes[1].Text(); noteText != "  > Test 2.1.2\n\ncontent 2.1.2\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
@@ -144,13 +154,13 @@ func TestMigrateAll(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].ChildNotes.Notes[0].ChildNotes.Notes[0].Text; noteText != "    - Test 2.1.1.1\n\ncontent 2.1.1.1\n" {
+	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].ChildNotes.Notes[0].ChildNotes.Notes[0].Text(); noteText != "    - Test 2.1.1.1\n\ncontent 2.1.1.1\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 }
 
 func TestParseNoteTree(t *testing.T) {
-	noteFileText := readNoteFile(t)
+	noteFileText := readTestNoteFile(t)
 
 	noteTree, err := ParseNoteTree(noteFileText)
 	if err != nil {
@@ -161,15 +171,15 @@ func TestParseNoteTree(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[0].Text; noteText != "- Test 1\n\ncontent 1\n" {
+	if noteText := noteTree.Notes[0].Text(); noteText != "- Test 1\n\ncontent 1\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
-	if noteText := noteTree.Notes[1].Text; noteText != "- Test 2\n\ncontent 2\n" {
+	if noteText := noteTree.Notes[1].Text(); noteText != "- Test 2\n\ncontent 2\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
-	if noteText := noteTree.Notes[2].Text; noteText != "- Test 3\n\ncontent 3\n" {
+	if noteText := noteTree.Notes[2].Text(); noteText != "- Test 3\n\ncontent 3\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
@@ -177,11 +187,11 @@ func TestParseNoteTree(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[0].ChildNotes.Notes[0].Text; noteText != "  - Test 1.1\n\ncontent 1.1\n" {
+	if noteText := noteTree.Notes[0].ChildNotes.Notes[0].Text(); noteText != "  - Test 1.1\n\ncontent 1.1\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
-	if noteText := noteTree.Notes[0].ChildNotes.Notes[1].Text; noteText != "  * Test 1.2\n\ncontent 1.2\n" {
+	if noteText := noteTree.Notes[0].ChildNotes.Notes[1].Text(); noteText != "  * Test 1.2\n\ncontent 1.2\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
@@ -189,7 +199,7 @@ func TestParseNoteTree(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[0].ChildNotes.Notes[0].ChildNotes.Notes[0].Text; noteText != "    * Test 1.1.1\n\ncontent 1.1.1\n" {
+	if noteText := noteTree.Notes[0].ChildNotes.Notes[0].ChildNotes.Notes[0].Text(); noteText != "    * Test 1.1.1\n\ncontent 1.1.1\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
@@ -197,7 +207,7 @@ func TestParseNoteTree(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].Text; noteText != " - Test 2.1\n\ncontent 2.1\n" {
+	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].Text(); noteText != " - Test 2.1\n\ncontent 2.1\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
@@ -205,11 +215,11 @@ func TestParseNoteTree(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].ChildNotes.Notes[0].Text; noteText != "  - Test 2.1.1\n\ncontent 2.1.1\n" {
+	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].ChildNotes.Notes[0].Text(); noteText != "  - Test 2.1.1\n\ncontent 2.1.1\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
-	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].ChildNotes.Notes[1].Text; noteText != "  * Test 2.1.2\n\ncontent 2.1.2\n" {
+	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].ChildNotes.Notes[1].Text(); noteText != "  * Test 2.1.2\n\ncontent 2.1.2\n" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
 
@@ -217,7 +227,571 @@ func TestParseNoteTree(t *testing.T) {
 		t.Fatalf("Incorrect note count in tree: %d", noteCount)
 	}
 
-	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].ChildNotes.Notes[0].ChildNotes.Notes[0].Text; noteText != "    - Test 2.1.1.1\n\ncontent 2.1.1.1\n" {
+	if noteText := noteTree.Notes[1].ChildNotes.Notes[0].ChildNotes.Notes[0].ChildNotes.Notes[0].Text(); noteText != "    - Test 2.1.1.1\n\ncontent 2.1.1.1\n" {
+		t.Fatalf("Unexpected note: %s", noteText)
+	}
+}
+
+func TestParseNoteTreeSplitsBulletLines(t *testing.T) {
+	noteTree, err := ParseNoteTree("- Test 1\n  *  Test 1.1\ncontent 1.1\n\n    x Test 1.1.1")
+	if err != nil {
+		t.Fatalf("Failed to parse note tree: %v", err)
+	}
+
+	note := noteTree.Notes[0].ChildNotes.Notes[0]
+	if note.Indent != "  " || note.Bullet != BulletTask || note.Spacing != "  " || note.Title != "Test 1.1" {
+		t.Fatalf("Unexpected note fields: %q %q %q %q", note.Indent, note.Bullet, note.Spacing, note.Title)
+	}
+
+	if len(note.Body) != 2 || note.Body[0] != "content 1.1" || note.Body[1] != "" {
+		t.Fatalf("Unexpected note body: %q", note.Body)
+	}
+
+	if noteText := note.Text(); noteText != "  *  Test 1.1\ncontent 1.1\n" {
+		t.Fatalf("Unexpected note: %s", noteText)
+	}
+
+	if bullet := note.ChildNotes.Notes[0].Bullet; bullet != BulletDone || bullet.Name() != "done" {
+		t.Fatalf("Unexpected bullet: %s", bullet)
+	}
+
+	if noteTreeText := noteTree.String(); noteTreeText != "- Test 1\n  *  Test 1.1\ncontent 1.1\n\n    x Test 1.1.1" {
+		t.Fatalf("Unexpected note tree: %s", noteTreeText)
+	}
+}
+
+func TestParseNoteTreeRoundTripsTestFiles(t *testing.T) {
+	err := filepath.WalkDir("./test", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != ".note" {
+			return err
+		}
+
+		fileContents, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+
+		noteTree, err := ParseNoteTree(string(fileContents))
+		if err != nil {
+			t.Fatalf("Failed to parse note tree: %v", err)
+		}
+
+		if noteTreeText := noteTree.String(); noteTreeText != string(fileContents) {
+			t.Errorf("Contents of %s changed after parsing:\n%q\n!=\n%q", path, noteTreeText, fileContents)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk test directory: %v", err)
+	}
+}
+
+func TestParseNoteTreeKeepsPreamble(t *testing.T) {
+	noteTree, err := ParseNoteTree("December 2019\n\n- a\n")
+	if err != nil {
+		t.Fatalf("Failed to parse note tree: %v", err)
+	}
+
+	if len(noteTree.Preamble) != 2 || noteTree.Preamble[0] != "December 2019" || noteTree.Preamble[1] != "" {
+		t.Fatalf("Unexpected preamble: %q", noteTree.Preamble)
+	}
+
+	if noteCount := len(noteTree.Notes); noteCount != 1 {
+		t.Fatalf("Incorrect note count in tree: %d", noteCount)
+	}
+
+	if !noteTree.FinalNewline {
+		t.Fatal("Final newline was not recorded")
+	}
+}
+
+func TestParseNoteTreeHandlesIrregularIndentation(t *testing.T) {
+	noteTree, err := ParseNoteTree("  - a\n    - a.1\n- b\n      - b.1\n    - b.2\n  - b.3\n        - b.3.1\n - b.4")
+	if err != nil {
+		t.Fatalf("Failed to parse note tree: %v", err)
+	}
+
+	if noteCount := len(noteTree.Notes); noteCount != 2 {
+		t.Fatalf("Incorrect note count in tree: %d", noteCount)
+	}
+
+	if noteText := noteTree.Notes[0].ChildNotes.Notes[0].Text(); noteText != "    - a.1" {
+		t.Fatalf("Unexpected note: %s", noteText)
+	}
+
+	// Dedenting to a depth that no ancestor has attaches the note to the closest less indented ancestor
+	bChildNotes := noteTree.Notes[1].ChildNotes.Notes
+	if noteCount := len(bChildNotes); noteCount != 4 {
+		t.Fatalf("Incorrect note count in tree: %d", noteCount)
+	}
+
+	for i, expectedText := range []string{"      - b.1", "    - b.2", "  - b.3", " - b.4"} {
+		if noteText := bChildNotes[i].Text(); noteText != expectedText {
+			t.Fatalf("Unexpected note: %s", noteText)
+		}
+	}
+
+	if noteText := bChildNotes[2].ChildNotes.Notes[0].Text(); noteText != "        - b.3.1" {
+		t.Fatalf("Unexpected note: %s", noteText)
+	}
+}
+
+func countNotes(noteTree NoteTree) int {
+	count := noteTree.Length()
+	for _, note := range noteTree.Notes {
+		count += countNotes(note.ChildNotes)
+	}
+
+	return count
+}
+
+func checkParseNoteTree(t *testing.T, text string) {
+	noteTree, err := ParseNoteTree(text)
+	if err != nil {
+		t.Fatalf("Failed to parse note tree: %v", err)
+	}
+
+	if noteTreeText := noteTree.String(); noteTreeText != text {
+		t.Fatalf("Text changed after parsing:\n%q\n!=\n%q", noteTreeText, text)
+	}
+
+	parser, err := newNoteParser(ParseOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+
+	if _, err := parser.parseLines(strings.NewReader(text)); err != nil {
+		t.Fatalf("Failed to parse notes: %v", err)
+	}
+
+	if noteCount := countNotes(noteTree); noteCount != len(parser.notes) {
+		t.Fatalf("Incorrect note count in tree: %d != %d", noteCount, len(parser.notes))
+	}
+}
+
+func TestParseNoteTreeKeepsEveryLineForRandomIndentation(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	lineFragments := []string{"- note", "* task", "x done", "text", "", "\t- tab", "> migrated"}
+
+	for i := 0; i < 1000; i++ {
+		var lines []string
+		for j := random.Intn(20); j > 0; j-- {
+			indent := strings.Repeat(" ", random.Intn(10))
+			lines = append(lines, indent+lineFragments[random.Intn(len(lineFragments))])
+		}
+
+		text := strings.Join(lines, "\n")
+		if random.Intn(2) == 0 {
+			text += "\n"
+		}
+
+		checkParseNoteTree(t, text)
+	}
+}
+
+func FuzzParseNoteTree(f *testing.F) {
+	f.Add("  - a\n- b")
+	f.Add("- a\n      - a.1\n   - a.2\n - a.3\n")
+	f.Add("preamble\n\n* task\n\tcontent\n")
+	f.Add("")
+	f.Add("\n")
+
+	f.Fuzz(checkParseNoteTree)
+}
+
+func TestParseNoteTreeReportsDiagnostics(t *testing.T) {
+	noteTree, err := ParseNoteTreeWithOptions("Heading\n  - a\n- b\n    - b.1\n  - b.2\n+ unknown", ParseOptions{File: "dec21.note"})
+	if err != nil {
+		t.Fatalf("Failed to parse note tree: %v", err)
+	}
+
+	expectedDiagnostics := []string{
+		"dec21.note:1:1: warning: Text before the first note does not belong to any note",
+		"dec21.note:2:3: error: Indented note has no parent note",
+		"dec21.note:5:3: error: Indentation does not match the note on line 4",
+		"dec21.note:6:1: warning: Unknown bullet \"+\"",
+	}
+
+	if len(noteTree.Diagnostics) != len(expectedDiagnostics) {
+		t.Fatalf("Unexpected diagnostics: %v", noteTree.Diagnostics)
+	}
+
+	for i, expectedDiagnostic := range expectedDiagnostics {
+		if diagnostic := noteTree.Diagnostics[i].Error(); diagnostic != expectedDiagnostic {
+			t.Fatalf("Unexpected diagnostic: %s", diagnostic)
+		}
+	}
+}
+
+func TestParseNoteTreeReturnsErrorsInStrictMode(t *testing.T) {
+	_, err := ParseNoteTreeWithOptions("Heading\n- a\n  - a.1\n - a.2\n", ParseOptions{Strict: true})
+
+	var parseErrors ParseErrors
+	if !errors.As(err, &parseErrors) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(parseErrors) != 1 || parseErrors[0].Line != 4 || parseErrors[0].Column != 2 || parseErrors[0].Severity != SeverityError {
+		t.Fatalf("Unexpected parse errors: %v", parseErrors)
+	}
+
+	if _, err := ParseNoteTreeWithOptions("Heading\n- a\n  - b\n", ParseOptions{Strict: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseNoteTreeOnlyReportsUnknownBulletsIndentedLikeNotes(t *testing.T) {
+	noteTree, err := ParseNoteTreeWithOptions("# Heading\n\n- a\n    > a quote\n    ```\n+ in a code block\n    ```\n", ParseOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var unknownBullets []ParseError
+	for _, diagnostic := range noteTree.Diagnostics {
+		if strings.HasPrefix(diagnostic.Message, "Unknown bullet") {
+			unknownBullets = append(unknownBullets, diagnostic)
+		}
+	}
+
+	if len(unknownBullets) != 0 {
+		t.Fatalf("Unexpected diagnostics: %v", unknownBullets)
+	}
+
+	noteTree, err = ParseNoteTreeWithOptions("# Heading\n\n- a\n  - a.1\n  + a.2\n+ b\n", ParseOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	unknownBullets = nil
+	for _, diagnostic := range noteTree.Diagnostics {
+		if strings.HasPrefix(diagnostic.Message, "Unknown bullet") {
+			unknownBullets = append(unknownBullets, diagnostic)
+		}
+	}
+
+	if len(unknownBullets) != 2 || unknownBullets[0].Line != 5 || unknownBullets[1].Line != 6 || unknownBullets[0].Severity != SeverityWarning {
+		t.Fatalf("Unexpected diagnostics: %v", unknownBullets)
+	}
+}
+
+func TestParseNoteTreeRequiresWhitespaceAfterBullet(t *testing.T) {
+	noteTree, err := ParseNoteTree("- a\nxylophone practice\n-->\n*emphasis*\n  \\* not a task\n-\n* b")
+	if err != nil {
+		t.Fatalf("Failed to parse note tree: %v", err)
+	}
+
+	if noteCount := len(noteTree.Notes); noteCount != 2 {
+		t.Fatalf("Incorrect note count in tree: %d", noteCount)
+	}
+
+	if noteText := noteTree.Notes[0].Text(); noteText != "- a\nxylophone practice\n-->\n*emphasis*\n  \\* not a task\n-" {
+		t.Fatalf("Unexpected note: %s", noteText)
+	}
+
+	bodyText, err := noteTree.Notes[0].BodyText()
+	if err != nil {
+		t.Fatalf("Failed to get body text: %v", err)
+	}
+	if bodyText != "xylophone practice\n-->\n*emphasis*\n  * not a task\n-" {
+		t.Fatalf("Unexpected body text: %s", bodyText)
+	}
+
+	if err := noteTree.FilterIncompleteTasks(); err != nil {
+		t.Fatalf("Failed to filter incomplete tasks: %v", err)
+	}
+
+	if noteCount := len(noteTree.Notes); noteCount != 1 || noteTree.Notes[0].Title != "b" {
+		t.Fatalf("Unexpected incomplete tasks: %s", noteTree)
+	}
+}
+
+func TestParseNoteTreeResolvesTabs(t *testing.T) {
+	text := "- a\n\t- a.1\n    - a.2\n  \t- a.3\n\t\t- a.3.1"
+
+	noteTree, err := ParseNoteTreeWithOptions(text, ParseOptions{TabWidth: 4})
+	if err != nil {
+		t.Fatalf("Failed to parse note tree: %v", err)
+	}
+
+	// With 4 column tabs, "\t" and "    " line up, and "  \t" lines up with "\t"
+	if noteCount := len(noteTree.Notes[0].ChildNotes.Notes); noteCount != 3 {
+		t.Fatalf("Incorrect note count in tree: %d", noteCount)
+	}
+
+	if noteCount := len(noteTree.Notes[0].ChildNotes.Notes[2].ChildNotes.Notes); noteCount != 1 {
+		t.Fatalf("Incorrect note count in tree: %d", noteCount)
+	}
+
+	expectedDiagnostics := []string{
+		"3:1: warning: Indentation uses spaces, but line 2 uses tabs",
+		"4:1: warning: Indentation mixes tabs and spaces",
+	}
+
+	if len(noteTree.Diagnostics) != len(expectedDiagnostics) {
+		t.Fatalf("Unexpected diagnostics: %v", noteTree.Diagnostics)
+	}
+
+	for i, expectedDiagnostic := range expectedDiagnostics {
+		if diagnostic := noteTree.Diagnostics[i].Error(); diagnostic != expectedDiagnostic {
+			t.Fatalf("Unexpected diagnostic: %s", diagnostic)
+		}
+	}
+
+	noteTree.NormalizeIndentation(4)
+	if noteTreeText := noteTree.String(); noteTreeText != "- a\n    - a.1\n    - a.2\n    - a.3\n        - a.3.1" {
+		t.Fatalf("Unexpected note tree: %s", noteTreeText)
+	}
+}
+
+func TestParseNoteTreeReaderReadsLongLines(t *testing.T) {
+	longTitle := strings.Repeat("a", 1024*1024)
+	text := "- short\n* " + longTitle + "\n- after\n"
+
+	noteTree, err := ParseNoteTreeReader(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("Failed to parse note tree: %v", err)
+	}
+
+	if noteCount := len(noteTree.Notes); noteCount != 3 {
+		t.Fatalf("Incorrect note count in tree: %d", noteCount)
+	}
+
+	if noteTree.Notes[1].Title != longTitle {
+		t.Fatal("Long note title was cut short")
+	}
+
+	var builder strings.Builder
+	if _, err := noteTree.WriteTo(&builder); err != nil {
+		t.Fatalf("Failed to write note tree: %v", err)
+	}
+
+	if builder.String() != text {
+		t.Fatal("Note tree text changed after parsing")
+	}
+}
+
+func TestParseNoteTreeReaderReturnsReadErrors(t *testing.T) {
+	reader := io.MultiReader(strings.NewReader("- a\n- b"), iotest.ErrReader(errors.New("disk on fire")))
+
+	if _, err := ParseNoteTreeReader(reader); err == nil || !strings.Contains(err.Error(), "disk on fire") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseNoteTreeKeepsCodeBlocksInNoteBodies(t *testing.T) {
+	text := "- deploy\n```sh\n- not a note\n* not a task\n\t> not migrated\n```\n  * check logs\n````\n```\n* still not a task\n````\n* real task"
+
+	noteTree, err := ParseNoteTree(text)
+	if err != nil {
+		t.Fatalf("Failed to parse note tree: %v", err)
+	}
+
+	if noteCount := countNotes(noteTree); noteCount != 3 {
+		t.Fatalf("Incorrect note count in tree: %d", noteCount)
+	}
+
+	if noteText := noteTree.Notes[0].Text(); noteText != "- deploy\n```sh\n- not a note\n* not a task\n\t> not migrated\n```" {
+		t.Fatalf("Unexpected note: %s", noteText)
+	}
+
+	if noteText := noteTree.Notes[0].ChildNotes.Notes[0].Text(); noteText != "  * check logs\n````\n```\n* still not a task\n````" {
+		t.Fatalf("Unexpected note: %s", noteText)
+	}
+
+	if len(noteTree.Diagnostics) != 0 {
+		t.Fatalf("Unexpected diagnostics: %v", noteTree.Diagnostics)
+	}
+
+	if err := noteTree.FilterIncompleteTasks(); err != nil {
+		t.Fatalf("Failed to filter incomplete tasks: %v", err)
+	}
+
+	if noteCount := countNotes(noteTree); noteCount != 3 {
+		t.Fatalf("Incorrect note count in tree: %d", noteCount)
+	}
+}
+
+func TestParseNoteTreeReportsUnclosedCodeBlocks(t *testing.T) {
+	noteTree, err := ParseNoteTree("- a\n```\n* not a task")
+	if err != nil {
+		t.Fatalf("Failed to parse note tree: %v", err)
+	}
+
+	if noteCount := countNotes(noteTree); noteCount != 1 {
+		t.Fatalf("Incorrect note count in tree: %d", noteCount)
+	}
+
+	if len(noteTree.Diagnostics) != 1 || noteTree.Diagnostics[0].Error() != "2:1: error: Code block is never closed" {
+		t.Fatalf("Unexpected diagnostics: %v", noteTree.Diagnostics)
+	}
+
+	if _, err := ParseNoteTreeWithOptions("- a\n```\n* b\n", ParseOptions{Strict: true}); err == nil {
+		t.Fatal("Expected an error for an unclosed code block in strict mode")
+	}
+}
+
+func TestParseNoteTreeParsesMetadata(t *testing.T) {
+	noteTree, err := ParseNoteTree("* fix login #backend @alice due:2020-01-10 see https://example.com at 10:30\n  - notes #backend")
+	if err != nil {
+		t.Fatalf("Failed to parse note tree: %v", err)
+	}
+
+	note := noteTree.Notes[0]
+	if len(note.Tags) != 1 || note.Tags[0] != "backend" {
+		t.Fatalf("Unexpected tags: %v", note.Tags)
+	}
+
+	if len(note.Mentions) != 1 || note.Mentions[0] != "alice" {
+		t.Fatalf("Unexpected mentions: %v", note.Mentions)
+	}
+
+	if len(note.Fields) != 1 || note.Fields["due"] != "2020-01-10" {
+		t.Fatalf("Unexpected fields: %v", note.Fields)
+	}
+
+	if noteText := note.Text(); noteText != "* fix login #backend @alice due:2020-01-10 see https://example.com at 10:30" {
 		t.Fatalf("Unexpected note: %s", noteText)
 	}
+
+	if !note.MatchesMetadata("#backend @alice due:2020-01-10") || note.MatchesMetadata("#backend @bob") || note.MatchesMetadata("due:2020-01-11") {
+		t.Fatal("Unexpected metadata match")
+	}
+
+	noteTree.Filter(func(note *Note) bool { return note.HasMention("alice") })
+	if noteCount := countNotes(noteTree); noteCount != 2 {
+		t.Fatalf("Incorrect note count in tree: %d", noteCount)
+	}
+}
+
+func testVocabulary(t *testing.T) *Vocabulary {
+	vocabulary, err := NewVocabulary([]BulletDefinition{
+		{Symbol: "o", Name: "event"},
+		{Symbol: "/", Name: "in progress", Open: true, MigratesTo: ">", CarryForward: true},
+		{Symbol: "!", Name: "blocked", Open: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create vocabulary: %v", err)
+	}
+
+	return vocabulary
+}
+
+func TestParseNoteTreeWithVocabulary(t *testing.T) {
+	noteTree, err := ParseNoteTreeWithOptions("o party\n  / write speech\n  ! buy cake\n  * call caterer\n+ unknown", ParseOptions{Vocabulary: testVocabulary(t)})
+	if err != nil {
+		t.Fatalf("Failed to parse note tree: %v", err)
+	}
+
+	if noteCount := countNotes(noteTree); noteCount != 4 {
+		t.Fatalf("Incorrect note count in tree: %d", noteCount)
+	}
+
+	if bulletName := noteTree.Notes[0].BulletName(); bulletName != "event" {
+		t.Fatalf("Unexpected bullet name: %s", bulletName)
+	}
+
+	noteTreeCopy := noteTree.Copy()
+	if err := noteTreeCopy.FilterIncompleteTasks(); err != nil {
+		t.Fatalf("Failed to filter incomplete tasks: %v", err)
+	}
+
+	if noteTreeText := noteTreeCopy.String(); noteTreeText != "o party\n  / write speech\n  * call caterer\n+ unknown" {
+		t.Fatalf("Unexpected note tree: %s", noteTreeText)
+	}
+
+	if err := noteTree.MigrateAll(); err != nil {
+		t.Fatalf("Failed to migrate notes: %v", err)
+	}
+
+	if noteTreeText := noteTree.String(); noteTreeText != "o party\n  > write speech\n  ! buy cake\n  > call caterer\n+ unknown" {
+		t.Fatalf("Unexpected note tree: %s", noteTreeText)
+	}
+}
+
+func TestNewVocabularyReturnsErrorForInvalidBullets(t *testing.T) {
+	invalidDefinitions := []BulletDefinition{
+		{Symbol: "ab"},
+		{Symbol: " "},
+		{Symbol: "\\"},
+		{Symbol: "/", MigratesTo: "%"},
+		{Symbol: "/", Open: true, CarryForward: true},
+		{Symbol: "/", CarryForward: true, MigratesTo: ">"},
+		{Symbol: "/", Open: true, CarryForward: true, MigratesTo: "*"},
+	}
+
+	for _, definition := range invalidDefinitions {
+		if _, err := NewVocabulary([]BulletDefinition{definition}); err == nil {
+			t.Fatalf("Expected an error for bullet %q", definition.Symbol)
+		}
+	}
+}
+
+func TestParseNoteTreeParsesSignifiers(t *testing.T) {
+	noteTree, err := ParseNoteTree("- a\n  * a.1\n  !- a.2\n- b\n  ** b.1\n?- c")
+	if err != nil {
+		t.Fatalf("Failed to parse note tree: %v", err)
+	}
+
+	if noteCount := countNotes(noteTree); noteCount != 6 {
+		t.Fatalf("Incorrect note count in tree: %d", noteCount)
+	}
+
+	aNotes := noteTree.Notes[0].ChildNotes.Notes
+	if aNotes[1].Signifiers != "!" || aNotes[1].Bullet != BulletNote || !aNotes[1].HasSignifier(SignifierInspiration) {
+		t.Fatalf("Unexpected note: %s", aNotes[1].Text())
+	}
+
+	bNote := noteTree.Notes[1].ChildNotes.Notes[0]
+	if bNote.Signifiers != "*" || bNote.Bullet != BulletTask || bNote.Title != "b.1" {
+		t.Fatalf("Unexpected note: %s", bNote.Text())
+	}
+
+	if !noteTree.Notes[2].HasSignifier(SignifierExplore) {
+		t.Fatalf("Unexpected note: %s", noteTree.Notes[2].Text())
+	}
+
+	if err := noteTree.FilterIncompleteTasks(); err != nil {
+		t.Fatalf("Failed to filter incomplete tasks: %v", err)
+	}
+
+	noteTree.SortPriorityFirst()
+	if noteTreeText := noteTree.String(); noteTreeText != "- b\n  ** b.1\n- a\n  * a.1" {
+		t.Fatalf("Unexpected note tree: %s", noteTreeText)
+	}
+
+	if err := noteTree.MigrateAll(); err != nil {
+		t.Fatalf("Failed to migrate notes: %v", err)
+	}
+
+	if noteTreeText := noteTree.String(); noteTreeText != "- b\n  *> b.1\n- a\n  > a.1" {
+		t.Fatalf("Unexpected note tree: %s", noteTreeText)
+	}
+}
+
+func TestNoteSetID(t *testing.T) {
+	noteTree, err := ParseNoteTree("* call bank ^k3f9\n* pay rent\n* ^ not an id\n*  ")
+	if err != nil {
+		t.Fatalf("Failed to parse note tree: %v", err)
+	}
+
+	if id := noteTree.Notes[0].ID; id != "k3f9" {
+		t.Fatalf("Unexpected ID: %s", id)
+	}
+
+	if id := noteTree.Notes[2].ID; id != "" {
+		t.Fatalf("Unexpected ID: %s", id)
+	}
+
+	noteTree.Notes[0].SetID("a1b2")
+	noteTree.Notes[1].SetID("c3d4")
+	noteTree.Notes[3].SetID("e5f6")
+
+	if noteTreeText := noteTree.String(); noteTreeText != "* call bank ^a1b2\n* pay rent ^c3d4\n* ^ not an id\n*  ^e5f6" {
+		t.Fatalf("Unexpected note tree: %s", noteTreeText)
+	}
+
+	if id := noteTree.Notes[1].ID; id != "c3d4" {
+		t.Fatalf("Unexpected ID: %s", id)
+	}
 }
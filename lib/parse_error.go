@@ -0,0 +1,61 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Severity int
+
+const (
+	SeverityWarning Severity = iota
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+
+	return "warning"
+}
+
+// A problem found while parsing a note file; lines and columns start at 1
+type ParseError struct {
+	File string
+	Line int
+	Column int
+	Severity Severity
+	Message string
+}
+
+func (e ParseError) Error() string {
+	location := fmt.Sprintf("%d:%d", e.Line, e.Column)
+	if e.File != "" {
+		location = e.File + ":" + location
+	}
+
+	return fmt.Sprintf("%s: %s: %s", location, e.Severity, e.Message)
+}
+
+type ParseErrors []ParseError
+
+func (e ParseErrors) Error() string {
+	var messages []string
+	for _, parseError := range(e) {
+		messages = append(messages, parseError.Error())
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+func (e ParseErrors) Errors() ParseErrors {
+	var parseErrors ParseErrors
+	for _, parseError := range(e) {
+		if parseError.Severity == SeverityError {
+			parseErrors = append(parseErrors, parseError)
+		}
+	}
+
+	return parseErrors
+}
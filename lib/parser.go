@@ -0,0 +1,270 @@
+package lib
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// A bullet is a bullet character followed by mandatory whitespace, so prose like "xylophone", "-->" or "*emphasis*" isn't a bullet
+// Signifiers may be written directly in front of the bullet, ex. "*- priority note" or "!* inspired task"
+var bulletLineRegexFormat string = "^(\\s*)([*!?]*)(%s)(\\s+)(.*)$"
+var unknownBulletRegexString string = "^(\\s*)([^\\s\\pL\\pN\\\\])\\s"
+
+type ParseOptions struct {
+	File string // Used in diagnostics
+	Strict bool // Return an error if there are any error diagnostics
+	TabWidth int // The number of columns between tab stops when resolving indentation, or 0 for the default
+	Vocabulary *Vocabulary // The bullets to recognise, or nil for the default bullets
+}
+
+// Lines between code fences (lines starting with at least 3 backticks) are kept as they are, and never parsed as bullets
+type codeFence struct {
+	marker string // The backticks that opened the current code block, or empty outside of a code block
+	line int
+}
+
+func fenceMarker(line string) string {
+	text := strings.TrimLeft(line, " \t")
+	marker := text[:len(text)-len(strings.TrimLeft(text, "`"))]
+	if len(marker) < 3 {
+		return ""
+	}
+
+	return marker
+}
+
+// Check whether a line is part of a code block, including the fence lines themselves
+func (f *codeFence) scan(line string, lineNumber int) bool {
+	marker := fenceMarker(line)
+	if f.marker == "" {
+		if marker == "" {
+			return false
+		}
+
+		f.marker = marker
+		f.line = lineNumber
+		return true
+	}
+
+	// A closing fence has at least as many backticks as the opening fence, and nothing else
+	if len(marker) >= len(f.marker) && strings.TrimSpace(line) == marker {
+		f.marker = ""
+	}
+
+	return true
+}
+
+// The parser reads one line at a time, so that files never need to be held in memory as a single string
+type noteParser struct {
+	options ParseOptions
+	bulletLineRegex *regexp.Regexp
+	unknownBulletRegex *regexp.Regexp
+	lineNumber int
+	preamble []string
+	notes []*Note
+	fileIndentStyle string
+	fileIndentStyleLine int
+	noteDepths []int // The depths of the last note and its ancestors
+	fence codeFence
+	diagnostics ParseErrors
+}
+
+func newNoteParser(options ParseOptions) (*noteParser, error) {
+	if options.Vocabulary == nil {
+		options.Vocabulary = defaultVocabulary
+	}
+
+	bulletLineRegex, err := regexp.Compile(fmt.Sprintf(bulletLineRegexFormat, options.Vocabulary.bulletRegexString()))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compile regex: %w", err)
+	}
+
+	unknownBulletRegex, err := regexp.Compile(unknownBulletRegexString)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compile regex: %w", err)
+	}
+
+	return &noteParser{options: options, bulletLineRegex: bulletLineRegex, unknownBulletRegex: unknownBulletRegex}, nil
+}
+
+func (p *noteParser) report(line, column int, severity Severity, format string, args ...any) {
+	p.diagnostics = append(p.diagnostics, ParseError{File: p.options.File, Line: line, Column: column, Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+func (p *noteParser) parseLine(line string) {
+	p.lineNumber++
+
+	if p.fence.scan(line, p.lineNumber) {
+		p.appendLine(line)
+		return
+	}
+
+	matches := p.bulletLineRegex.FindStringSubmatch(line)
+	if matches != nil {
+		indent := matches[1]
+		note := &Note{
+			Indent: indent,
+			Signifiers: matches[2],
+			Bullet: bulletOf(matches[3]),
+			Spacing: matches[4],
+			Title: matches[5],
+			Depth: indentWidth(indent, p.options.TabWidth),
+			Line: p.lineNumber,
+			vocabulary: p.options.Vocabulary,
+		}
+		note.parseMetadata()
+		p.notes = append(p.notes, note)
+
+		for len(p.noteDepths) > 0 && p.noteDepths[len(p.noteDepths)-1] >= note.Depth {
+			p.noteDepths = p.noteDepths[:len(p.noteDepths)-1]
+		}
+		p.noteDepths = append(p.noteDepths, note.Depth)
+
+		// Warn about indentation that would change meaning with a different tab width
+		noteIndentStyle := indentStyle(indent)
+		if noteIndentStyle == "tabs and spaces" {
+			p.report(p.lineNumber, 1, SeverityWarning, "Indentation mixes tabs and spaces")
+		} else if noteIndentStyle != "" && p.fileIndentStyle == "" {
+			p.fileIndentStyle = noteIndentStyle
+			p.fileIndentStyleLine = p.lineNumber
+		} else if noteIndentStyle != "" && noteIndentStyle != p.fileIndentStyle {
+			p.report(p.lineNumber, 1, SeverityWarning, "Indentation uses %s, but line %d uses %s", noteIndentStyle, p.fileIndentStyleLine, p.fileIndentStyle)
+		}
+
+		return
+	}
+
+	// Only lines indented like a note could be meant as one, so other text, such as markdown in a note body, isn't reported
+	if matches := p.unknownBulletRegex.FindStringSubmatch(line); matches != nil && slices.Contains(p.noteDepths, indentWidth(matches[1], p.options.TabWidth)) {
+		p.report(p.lineNumber, len(matches[1]) + 1, SeverityWarning, "Unknown bullet %q", matches[2])
+	}
+
+	if len(p.notes) == 0 && strings.TrimSpace(line) != "" {
+		p.report(p.lineNumber, len(line) - len(strings.TrimLeft(line, " \t")) + 1, SeverityWarning, "Text before the first note does not belong to any note")
+	}
+
+	p.appendLine(line)
+}
+
+// Append non-bullet notes to the previous note
+func (p *noteParser) appendLine(line string) {
+	if len(p.notes) == 0 {
+		p.preamble = append(p.preamble, line) // Keep non-bullet notes at the top of the file
+		return
+	}
+
+	p.notes[len(p.notes)-1].AddBodyLine(line)
+}
+
+// Parse each line, and return whether the last line ended with a newline
+// Lines are read without a length limit
+func (p *noteParser) parseLines(r io.Reader) (bool, error) {
+	reader := bufio.NewReader(r)
+
+	finalNewline := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			if line != "" {
+				p.parseLine(line)
+				finalNewline = false
+			}
+
+			// Every line after an unclosed fence is kept as it is, so any tasks there would silently never be migrated
+			if p.fence.marker != "" {
+				p.report(p.fence.line, 1, SeverityError, "Code block is never closed")
+			}
+
+			return finalNewline, nil
+		} else if err != nil {
+			return false, fmt.Errorf("Failed to read line %d: %w", p.lineNumber + 1, err)
+		}
+
+		p.parseLine(strings.TrimSuffix(line, "\n"))
+		finalNewline = true
+	}
+}
+
+// Note: Implementing this recursively results in a less readable implementation
+// You need to keep track of the current index in the notes array throughout the recursive calls
+// You can pass the index by reference, but it makes the code much more complicated
+//
+// Each note is attached to the closest preceding note with a smaller depth, or to the top of the tree if there isn't one
+// So leading indentation, and dedents to a depth that no ancestor has, never leave a note without a parent
+func (p *noteParser) parseNoteTrees(notes []*Note) (NoteTree, error) {
+	var noteStack Stack
+
+	rootNote := Note{Depth: -1}
+	noteStack.Push(&rootNote)
+
+	for _, note := range(notes) {
+		parentNote := noteStack.Peek().(*Note)
+
+		// Pop parent notes until we reach one that is less indented than this note
+		for parentNote.Depth >= note.Depth {
+			noteStack.Pop()
+			parentNote = noteStack.Peek().(*Note)
+		}
+
+		if parentNote == &rootNote {
+			if note.Depth > 0 {
+				p.report(note.Line, len(note.Indent) + 1, SeverityError, "Indented note has no parent note")
+			}
+		} else if siblingNotes := parentNote.ChildNotes.Notes; len(siblingNotes) > 0 && siblingNotes[len(siblingNotes)-1].Depth != note.Depth {
+			siblingNote := siblingNotes[len(siblingNotes)-1]
+			p.report(note.Line, len(note.Indent) + 1, SeverityError, "Indentation does not match the note on line %d", siblingNote.Line)
+		}
+
+		parentNote.ChildNotes.Add(note)
+		noteStack.Push(note)
+	}
+
+	return rootNote.ChildNotes, nil
+}
+
+// Parse text into a note tree; calling String on the result gives back the original text exactly
+func ParseNoteTree(text string) (NoteTree, error) {
+	return ParseNoteTreeReaderWithOptions(strings.NewReader(text), ParseOptions{})
+}
+
+func ParseNoteTreeWithOptions(text string, options ParseOptions) (NoteTree, error) {
+	return ParseNoteTreeReaderWithOptions(strings.NewReader(text), options)
+}
+
+func ParseNoteTreeReader(r io.Reader) (NoteTree, error) {
+	return ParseNoteTreeReaderWithOptions(r, ParseOptions{})
+}
+
+func ParseNoteTreeReaderWithOptions(r io.Reader, options ParseOptions) (NoteTree, error) {
+	var noteTree NoteTree
+
+	parser, err := newNoteParser(options)
+	if err != nil {
+		return noteTree, fmt.Errorf("Failed to create parser: %w", err)
+	}
+
+	finalNewline, err := parser.parseLines(r)
+	if err != nil {
+		return noteTree, fmt.Errorf("Failed to parse notes: %w", err)
+	}
+
+	if noteTree, err = parser.parseNoteTrees(parser.notes); err != nil {
+		return noteTree, fmt.Errorf("Failed to parse note trees: %w", err)
+	}
+
+	noteTree.Preamble = parser.preamble
+	noteTree.FinalNewline = finalNewline
+	noteTree.Diagnostics = parser.diagnostics
+	slices.SortStableFunc(noteTree.Diagnostics, func(a, b ParseError) int { return cmp.Compare(a.Line, b.Line) })
+
+	if parseErrors := parser.diagnostics.Errors(); options.Strict && len(parseErrors) > 0 {
+		return noteTree, parseErrors
+	}
+
+	return noteTree, nil
+}
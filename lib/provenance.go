@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Migrations can annotate tasks with where they were migrated to and from, ex. "> call bank → dec25" and "* call bank ← dec21"
+var migratedToMarker string = "→"
+var migratedFromMarker string = "←"
+
+func parseMarker(title, marker string) string {
+	tokens := strings.Fields(title)
+	value := ""
+	for i := 0; i < len(tokens)-1; i++ {
+		if tokens[i] == marker {
+			value = tokens[i+1]
+		}
+	}
+
+	return value
+}
+
+// Add text to the end of the title, in front of the ID if there is one
+func (n *Note) appendToTitle(text string) {
+	title := joinTitle(n.titleWithoutID(), text)
+	if n.ID != "" {
+		title = joinTitle(title, "^" + n.ID)
+	}
+
+	n.Title = title
+	n.parseMetadata()
+}
+
+// Replace any existing marker in the title with a new one
+func (n *Note) setMarker(marker, value string) {
+	r := regexp.MustCompile("\\s*" + regexp.QuoteMeta(marker) + "\\s+\\S+")
+
+	id := n.ID
+	n.Title = r.ReplaceAllString(n.titleWithoutID(), "")
+	if id != "" {
+		n.Title = joinTitle(n.Title, "^" + id)
+	}
+
+	n.appendToTitle(marker + " " + value)
+}
+
+func (n *Note) SetMigratedTo(noteFileName string) {
+	n.setMarker(migratedToMarker, noteFileName)
+}
+
+func (n *Note) SetMigratedFrom(noteFileName string) {
+	n.setMarker(migratedFromMarker, noteFileName)
+}
@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var errReviewEnded = errors.New("Review ended before every task was reviewed")
+
+type ReviewDecision int
+
+const (
+	ReviewMigrate ReviewDecision = iota
+	ReviewComplete
+	ReviewCancel
+	ReviewSchedule
+)
+
+// The bullet a task is given in its original note file for each decision
+// Migrated tasks are migrated as usual
+var reviewDecisionBullets = map[ReviewDecision]Bullet{
+	ReviewComplete: BulletDone,
+	ReviewCancel: BulletCancelled,
+	ReviewSchedule: BulletScheduled,
+}
+
+// A reviewer decides what happens to each task that a migration would carry forward
+type Reviewer interface {
+	Review(noteFilePath string, note *Note, parentNotes []*Note) (ReviewDecision, error)
+}
+
+type promptReviewer struct {
+	in *bufio.Reader
+	out io.Writer
+}
+
+// Ask about each task on out, and read the answers from in, one per line
+// Answers are the bullet the task gets: ">" (migrate), "x" (complete), "~" (cancel) or "<" (schedule)
+// "m", "c" and "s" also migrate, complete and schedule
+func NewPromptReviewer(in io.Reader, out io.Writer) Reviewer {
+	return &promptReviewer{in: bufio.NewReader(in), out: out}
+}
+
+func (r *promptReviewer) Review(noteFilePath string, note *Note, parentNotes []*Note) (ReviewDecision, error) {
+	fmt.Fprintf(r.out, "%s:%d\n", noteFilePath, note.Line)
+	for _, parentNote := range(parentNotes) {
+		fmt.Fprintln(r.out, parentNote.bulletLine())
+	}
+	fmt.Fprintln(r.out, note.bulletLine())
+
+	for {
+		fmt.Fprint(r.out, "[>] migrate, [x] complete, [~] cancel or [<] schedule? ")
+
+		answer, err := r.in.ReadString('\n')
+		if err != nil && (err != io.EOF || answer == "") {
+			fmt.Fprintln(r.out)
+			return ReviewMigrate, errReviewEnded
+		}
+
+		switch strings.TrimSpace(answer) {
+		case ">", "m":
+			return ReviewMigrate, nil
+		case "x", "c":
+			return ReviewComplete, nil
+		case "~":
+			return ReviewCancel, nil
+		case "<", "s":
+			return ReviewSchedule, nil
+		}
+
+		fmt.Fprintf(r.out, "Unknown answer %q, answer >, x, ~ or <\n", strings.TrimSpace(answer))
+	}
+}
+
+func (noteTree NoteTree) walkWithParents(parentNotes []*Note, visit func(*Note, []*Note) error) error {
+	for _, note := range(noteTree.Notes) {
+		if err := visit(note, parentNotes); err != nil {
+			return err
+		}
+
+		if err := note.ChildNotes.walkWithParents(append(parentNotes[:len(parentNotes):len(parentNotes)], note), visit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ask the reviewer about every task that would be carried forward, and give the tasks that won't be migrated their new bullet
+// Tasks under a task that won't be migrated are given the same bullet, so they aren't asked about
+func (noteTree NoteTree) Review(noteFilePath string, reviewer Reviewer, isMigrationCandidate func(*Note) bool) error {
+	return noteTree.walkWithParents(nil, func(note *Note, parentNotes []*Note) error {
+		if !isMigrationCandidate(note) {
+			return nil
+		}
+
+		decision, err := reviewer.Review(noteFilePath, note, parentNotes)
+		if err != nil {
+			return fmt.Errorf("Failed to review task: %w", err)
+		}
+
+		if bullet, ok := reviewDecisionBullets[decision]; ok {
+			note.withdraw(bullet, isMigrationCandidate)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var rootEnvVar string = "BUJO_ROOT"
+var userConfigFile string = filepath.Join("bujo", "config.json")
+
+// User-level configuration, read from bujo/config.json in the user's config directory
+type UserConfig struct {
+	Root string `json:"root"` // The notes root directory, where "~/" is the home directory
+}
+
+// The user config directory is $XDG_CONFIG_HOME if it is set, otherwise the platform's default
+func userConfigFilePath() (string, error) {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		var err error
+		configDir, err = os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("Failed to find user config directory: %w", err)
+		}
+	}
+
+	return filepath.Join(configDir, userConfigFile), nil
+}
+
+func LoadUserConfig() (UserConfig, error) {
+	var config UserConfig
+
+	configFilePath, err := userConfigFilePath()
+	if err != nil {
+		return config, nil // Use the defaults if there isn't a config directory
+	}
+
+	configBytes, err := os.ReadFile(configFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil // Use the defaults if there isn't a config file
+	} else if err != nil {
+		return config, fmt.Errorf("Failed to read user config file: %w", err)
+	}
+
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return config, fmt.Errorf("Failed to parse user config file: %w", err)
+	}
+
+	return config, nil
+}
+
+func expandHomeDir(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("Failed to find home directory: %w", err)
+	}
+
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~")), nil
+}
+
+// Find the notes root directory from the first of: the given root (ex. from a flag), $BUJO_ROOT, the user config file, or ./notes
+func ResolveNotesRootDir(root string) (string, error) {
+	if root != "" {
+		return expandHomeDir(root)
+	}
+
+	if root := os.Getenv(rootEnvVar); root != "" {
+		return expandHomeDir(root)
+	}
+
+	userConfig, err := LoadUserConfig()
+	if err != nil {
+		return "", fmt.Errorf("Failed to load user config: %w", err)
+	}
+
+	if userConfig.Root != "" {
+		return expandHomeDir(userConfig.Root)
+	}
+
+	return defaultNotesRootDir, nil
+}
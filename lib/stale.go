@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+)
+
+var defaultStaleThreshold int = 3
+
+var StaleActionCancel string = "cancel"
+var StaleActionFlag string = "flag"
+var staleTag string = "stale"
+
+// Tasks are the same task if they have the same ID, or if neither has an ID, the same title (ignoring annotations added by migrations)
+func (n Note) taskKey() string {
+	if n.ID != "" {
+		return "^" + n.ID
+	}
+
+	return n.titleKey()
+}
+
+func (n Note) titleKey() string {
+	var tokens []string
+	titleTokens := strings.Fields(n.titleWithoutID())
+	for i := 0; i < len(titleTokens); i++ {
+		if titleTokens[i] == migratedToMarker || titleTokens[i] == migratedFromMarker {
+			i++ // Skip the marker, and the name after it
+			continue
+		} else if titleTokens[i] == "#" + staleTag {
+			continue
+		}
+
+		tokens = append(tokens, titleTokens[i])
+	}
+
+	return strings.Join(tokens, " ")
+}
+
+// Check whether the note has a bullet that open bullets become when they are migrated
+func (n Note) isMigrated() bool {
+	for _, definition := range(n.Vocabulary().definitions) {
+		if definition.Open && definition.MigratesTo != "" && bulletOf(definition.MigratesTo) == n.Bullet {
+			return true
+		}
+	}
+
+	return false
+}
+
+// How many times each task has been migrated since it was last closed
+type taskMigrationCounts map[string]int
+
+// A task with an ID that isn't in the journal yet was given it by this migration, so it still has the count of its title
+func (counts taskMigrationCounts) of(note *Note) int {
+	if count, ok := counts[note.taskKey()]; ok {
+		return count
+	}
+
+	return counts[note.titleKey()]
+}
+
+// Count how many times each task has been migrated, using the migrated copies of it in the journal
+// The journal is read in order, and a task that is closed starts over, so a recurring task with the same title isn't counted as the same task
+func (j *Journal) migrationCounts() (taskMigrationCounts, error) {
+	migrationCounts := make(taskMigrationCounts)
+	err := j.walkNotes(func(noteFilePath string, note *Note) {
+		taskKey := note.taskKey()
+		migrationCounts[taskKey] = migrationCounts.of(note)
+
+		if note.isMigrated() {
+			migrationCounts[taskKey]++
+		} else if !note.IsOpen() {
+			migrationCounts[taskKey] = 0
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to count migrations: %w", err)
+	}
+
+	return migrationCounts, nil
+}
+
+func (j *Journal) staleThreshold() int {
+	if j.Config.StaleThreshold > 0 {
+		return j.Config.StaleThreshold
+	}
+
+	return defaultStaleThreshold
+}
+
+type StaleTask struct {
+	TaskOccurrence
+	Migrations int
+}
+
+func (t StaleTask) String() string {
+	return fmt.Sprintf("%s (migrated %d times)", t.TaskOccurrence, t.Migrations)
+}
+
+// Find the open tasks that have been migrated at least threshold times
+// A threshold of 0 uses the threshold from the journal config
+func (j *Journal) StaleTasks(threshold int) ([]StaleTask, error) {
+	if threshold <= 0 {
+		threshold = j.staleThreshold()
+	}
+
+	migrationCounts, err := j.migrationCounts()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to count migrations: %w", err)
+	}
+
+	var staleTasks []StaleTask
+	err = j.walkNotes(func(noteFilePath string, note *Note) {
+		if migrations := migrationCounts.of(note); note.IsOpen() && migrations >= threshold {
+			occurrence := TaskOccurrence{Path: noteFilePath, Line: note.Line, Bullet: note.Bullet, Title: note.Title}
+			staleTasks = append(staleTasks, StaleTask{TaskOccurrence: occurrence, Migrations: migrations})
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find stale tasks: %w", err)
+	}
+
+	return staleTasks, nil
+}
+
+func StaleTasks(notesRootDir string, threshold int) ([]StaleTask, error) {
+	journal, err := OpenJournal(notesRootDir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open journal: %w", err)
+	}
+
+	return journal.StaleTasks(threshold)
+}
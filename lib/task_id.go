@@ -0,0 +1,128 @@
+package lib
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Tasks are given a stable ID when they are migrated, written as a trailing marker in the title, ex. "* call bank ^k3f9"
+// The ID is copied along with the task, so that a task can be followed across the journal
+var taskIDLength int = 4
+
+func parseTaskID(title string) string {
+	tokens := strings.Fields(title)
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	lastToken := tokens[len(tokens)-1]
+	if len(lastToken) < 2 || lastToken[0] != '^' {
+		return ""
+	}
+
+	for _, c := range(lastToken[1:]) {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z') {
+			return ""
+		}
+	}
+
+	return lastToken[1:]
+}
+
+func (n Note) titleWithoutID() string {
+	if n.ID == "" {
+		return n.Title
+	}
+
+	return strings.TrimRight(strings.TrimSuffix(strings.TrimRight(n.Title, " \t"), "^" + n.ID), " \t")
+}
+
+func joinTitle(title, text string) string {
+	if title == "" {
+		return text
+	}
+
+	return title + " " + text
+}
+
+func (n *Note) SetID(id string) {
+	n.Title = joinTitle(n.titleWithoutID(), "^" + id)
+	n.parseMetadata()
+}
+
+// Generate an ID from the seed, which isn't in the existing IDs
+// The same seed and existing IDs always give the same ID
+func generateTaskID(seed string, existingIDs map[string]bool) string {
+	for attempt := 0; ; attempt++ {
+		hash := fnv.New64a()
+		fmt.Fprintf(hash, "%s\x00%d", seed, attempt)
+
+		id := strconv.FormatUint(hash.Sum64(), 36)
+		id = strings.Repeat("0", taskIDLength) + id
+		id = id[len(id)-taskIDLength:]
+		if !existingIDs[id] {
+			existingIDs[id] = true
+			return id
+		}
+	}
+}
+
+// Give every matching note without an ID a new ID
+func (noteTree NoteTree) AssignTaskIDs(match func(*Note) bool, newID func(*Note) string) {
+	noteTree.Walk(func(note *Note) {
+		if note.ID == "" && match(note) {
+			note.SetID(newID(note))
+		}
+	})
+}
+
+func (j *Journal) taskIDs() (map[string]bool, error) {
+	taskIDs := make(map[string]bool)
+	err := j.walkNotes(func(noteFilePath string, note *Note) {
+		if note.ID != "" {
+			taskIDs[note.ID] = true
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find task IDs: %w", err)
+	}
+
+	return taskIDs, nil
+}
+
+type TaskOccurrence struct {
+	Path string
+	Line int
+	Bullet Bullet
+	Title string
+}
+
+func (o TaskOccurrence) String() string {
+	return fmt.Sprintf("%s:%d: %s %s", o.Path, o.Line, o.Bullet, o.Title)
+}
+
+// Find every occurrence of a task in the journal
+func (j *Journal) TaskHistory(id string) ([]TaskOccurrence, error) {
+	var occurrences []TaskOccurrence
+	err := j.walkNotes(func(noteFilePath string, note *Note) {
+		if note.ID == id {
+			occurrences = append(occurrences, TaskOccurrence{Path: noteFilePath, Line: note.Line, Bullet: note.Bullet, Title: note.Title})
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find task: %w", err)
+	}
+
+	return occurrences, nil
+}
+
+func TaskHistory(notesRootDir, id string) ([]TaskOccurrence, error) {
+	journal, err := OpenJournal(notesRootDir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open journal: %w", err)
+	}
+
+	return journal.TaskHistory(strings.TrimPrefix(id, "^"))
+}
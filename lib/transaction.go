@@ -0,0 +1,238 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Migrations keep their own files in a hidden directory in the notes root directory
+var stateDir string = ".bujo"
+var transactionFile string = "transaction.json"
+
+var errMigrationInterrupted = errors.New("A migration was interrupted, and will be finished by the next migration")
+
+// Staged files are hidden and don't end in ".note", so they are never mistaken for note files
+var stagedFileSuffix string = ".staged"
+
+// Replaced in tests to simulate a crash part way through a migration
+var renameFile = os.Rename
+
+// A transaction records which staged files replace which files, and which files are removed, so that a migration that was interrupted can be finished
+// Paths are relative to the notes root directory
+type transaction struct {
+	Files []stagedFile `json:"files"`
+}
+
+type stagedFile struct {
+	Path string `json:"path"`
+	StagedPath string `json:"staged_path,omitempty"` // Empty if the file is removed
+}
+
+func (j *Journal) transactionFilePath() string {
+	return filepath.Join(j.RootDir, stateDir, transactionFile)
+}
+
+// Write a new hidden file next to a file, and make sure it is on disk
+func stageFile(filePath string, write func(io.Writer) error) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return "", fmt.Errorf("Failed to create directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(filePath), "." + filepath.Base(filePath) + ".*" + stagedFileSuffix)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create staged file: %w", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	if err = write(writer); err != nil {
+		err = fmt.Errorf("Failed to write file: %w", err)
+	} else if err = writer.Flush(); err != nil {
+		err = fmt.Errorf("Failed to flush file: %w", err)
+	} else if err = file.Chmod(0644); err != nil {
+		err = fmt.Errorf("Failed to set file permissions: %w", err)
+	} else if err = file.Sync(); err != nil {
+		err = fmt.Errorf("Failed to sync file: %w", err)
+	}
+
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("Failed to close file: %w", closeErr)
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+func writeBytes(data []byte) func(io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}
+}
+
+// Change several files at once: each file is staged first, then the transaction is recorded, then the staged files replace the files
+// If a migration stops before the transaction is recorded nothing has changed, and the staged files are removed by the next migration
+// If it stops after, the next migration finishes it
+type transactionBuilder struct {
+	journal *Journal
+	transaction transaction
+}
+
+func (j *Journal) newTransaction() *transactionBuilder {
+	return &transactionBuilder{journal: j}
+}
+
+func (b *transactionBuilder) relativePath(filePath string) (string, error) {
+	relativePath, err := filepath.Rel(b.journal.RootDir, filePath)
+	if err != nil {
+		b.abort()
+		return "", fmt.Errorf("Failed to get relative file path: %w", err)
+	}
+
+	return relativePath, nil
+}
+
+// Stage the new contents of a file
+func (b *transactionBuilder) stage(filePath string, write func(io.Writer) error) error {
+	relativePath, err := b.relativePath(filePath)
+	if err != nil {
+		return err
+	}
+
+	stagedFilePath, err := stageFile(filePath, write)
+	if err != nil {
+		b.abort()
+		return fmt.Errorf("Failed to stage file: %w", err)
+	}
+
+	b.transaction.Files = append(b.transaction.Files, stagedFile{Path: relativePath, StagedPath: filepath.Join(filepath.Dir(relativePath), filepath.Base(stagedFilePath))})
+
+	return nil
+}
+
+func (b *transactionBuilder) remove(filePath string) error {
+	relativePath, err := b.relativePath(filePath)
+	if err != nil {
+		return err
+	}
+
+	b.transaction.Files = append(b.transaction.Files, stagedFile{Path: relativePath})
+
+	return nil
+}
+
+// Remove the staged files without changing anything
+func (b *transactionBuilder) abort() {
+	for _, file := range(b.transaction.Files) {
+		if file.StagedPath != "" {
+			os.Remove(filepath.Join(b.journal.RootDir, file.StagedPath))
+		}
+	}
+}
+
+func (b *transactionBuilder) commit() error {
+	transactionBytes, err := json.MarshalIndent(b.transaction, "", "  ")
+	if err != nil {
+		b.abort()
+		return fmt.Errorf("Failed to encode transaction: %w", err)
+	}
+
+	stagedFilePath, err := stageFile(b.journal.transactionFilePath(), writeBytes(transactionBytes))
+	if err != nil {
+		b.abort()
+		return fmt.Errorf("Failed to stage transaction: %w", err)
+	}
+
+	if err := os.Rename(stagedFilePath, b.journal.transactionFilePath()); err != nil {
+		os.Remove(stagedFilePath)
+		b.abort()
+		return fmt.Errorf("Failed to record transaction: %w", err)
+	}
+
+	return b.journal.commitTransaction(b.transaction)
+}
+
+// Replace each file with its staged file, or remove it, then forget the transaction
+// Staged files that are already gone have already replaced their files
+func (j *Journal) commitTransaction(t transaction) error {
+	for _, file := range(t.Files) {
+		if file.StagedPath == "" {
+			if err := os.Remove(filepath.Join(j.RootDir, file.Path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("Failed to remove file: %w", err)
+			}
+
+			continue
+		}
+
+		err := renameFile(filepath.Join(j.RootDir, file.StagedPath), filepath.Join(j.RootDir, file.Path))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("Failed to replace file: %w", err)
+		}
+	}
+
+	if err := os.Remove(j.transactionFilePath()); err != nil {
+		return fmt.Errorf("Failed to remove transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (j *Journal) hasPendingTransaction() (bool, error) {
+	if _, err := os.Stat(j.transactionFilePath()); err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("Failed to stat transaction: %w", err)
+	} else if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Finish a migration that was interrupted after its transaction was recorded, or remove the staged files of one that was interrupted before
+func (j *Journal) recoverTransaction() error {
+	transactionBytes, err := os.ReadFile(j.transactionFilePath())
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to read transaction: %w", err)
+	} else if err == nil {
+		var t transaction
+		if err := json.Unmarshal(transactionBytes, &t); err != nil {
+			return fmt.Errorf("Failed to decode transaction: %w", err)
+		}
+
+		if err := j.commitTransaction(t); err != nil {
+			return fmt.Errorf("Failed to finish interrupted migration: %w", err)
+		}
+	}
+
+	err = filepath.WalkDir(j.RootDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() && path != j.RootDir && strings.HasPrefix(entry.Name(), ".") && entry.Name() != stateDir {
+			return filepath.SkipDir
+		}
+
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), ".") && strings.HasSuffix(entry.Name(), stagedFileSuffix) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to remove staged files: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var undoSnapshotFile string = "undo.json"
+var undoBackupDir string = "undo"
+
+var errNothingToUndo = errors.New("There is no migration to undo")
+var errEditedSinceMigration = errors.New("File was edited after the migration")
+
+// The files changed by the last migration, with a copy of each file from before it, and a hash of their contents from after it
+// Paths are relative to the notes root directory
+type undoSnapshot struct {
+	Files []undoFile `json:"files"`
+}
+
+type undoFile struct {
+	Path string `json:"path"`
+	BackupPath string `json:"backup_path,omitempty"` // Empty if the file was created
+	Created bool `json:"created"`
+	CreatedDirs []string `json:"created_dirs,omitempty"` // The directories created for the file, innermost first
+	AfterHash string `json:"after_hash"` // sha256, in hex
+}
+
+func (j *Journal) undoFilePath() string {
+	return filepath.Join(j.RootDir, stateDir, undoSnapshotFile)
+}
+
+// Read the snapshot of the last migration, or an empty snapshot if there isn't one
+func (j *Journal) readUndoSnapshot() (undoSnapshot, error) {
+	var snapshot undoSnapshot
+
+	snapshotBytes, err := os.ReadFile(j.undoFilePath())
+	if err != nil && !os.IsNotExist(err) {
+		return snapshot, fmt.Errorf("Failed to read undo snapshot: %w", err)
+	} else if os.IsNotExist(err) {
+		return snapshot, nil
+	}
+
+	if err := json.Unmarshal(snapshotBytes, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("Failed to decode undo snapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// The directories in the journal that don't exist yet and would be created for a file, innermost first, relative to the notes root directory
+func (j *Journal) missingDirs(filePath string) ([]string, error) {
+	var dirs []string
+	for dir := filepath.Dir(filePath); dir != j.RootDir && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("Failed to stat directory: %w", err)
+		}
+
+		relativeDir, err := filepath.Rel(j.RootDir, dir)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get relative directory path: %w", err)
+		}
+
+		dirs = append(dirs, relativeDir)
+	}
+
+	return dirs, nil
+}
+
+// Copy a file a piece at a time
+func copyFile(filePath string) func(io.Writer) error {
+	return func(w io.Writer) error {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return fmt.Errorf("Failed to open file: %w", err)
+		}
+		defer file.Close()
+
+		_, err = io.Copy(w, file)
+		return err
+	}
+}
+
+func hashFile(filePath string) (string, error) {
+	hash := sha256.New()
+	if err := copyFile(filePath)(hash); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Restore every file changed by the last migration, and remove the file it created
+// Nothing is changed if any of the files were edited after the migration
+func (j *Journal) Undo(wait bool) error {
+	unlock, err := j.lock(wait)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := j.recoverTransaction(); err != nil {
+		return fmt.Errorf("Failed to recover interrupted migration: %w", err)
+	}
+
+	snapshot, err := j.readUndoSnapshot()
+	if err != nil {
+		return err
+	} else if len(snapshot.Files) == 0 {
+		return errNothingToUndo
+	}
+
+	for _, file := range(snapshot.Files) {
+		hash, err := hashFile(filepath.Join(j.RootDir, file.Path))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("Failed to hash file: %w", err)
+		}
+
+		if hash != file.AfterHash {
+			return fmt.Errorf("%w: %s", errEditedSinceMigration, file.Path)
+		}
+	}
+
+	t := j.newTransaction()
+	for _, file := range(snapshot.Files) {
+		filePath := filepath.Join(j.RootDir, file.Path)
+		if file.Created {
+			err = t.remove(filePath)
+		} else if err = t.stage(filePath, copyFile(filepath.Join(j.RootDir, file.BackupPath))); err == nil {
+			err = t.remove(filepath.Join(j.RootDir, file.BackupPath))
+		}
+
+		if err != nil {
+			return fmt.Errorf("Failed to restore file: %w", err)
+		}
+	}
+
+	if err := t.remove(j.undoFilePath()); err != nil {
+		return fmt.Errorf("Failed to remove undo snapshot: %w", err)
+	}
+
+	if err := t.commit(); err != nil {
+		return err
+	}
+
+	// Remove the directories the migration created, unless something else was put in them since
+	for _, file := range(snapshot.Files) {
+		for _, dir := range(file.CreatedDirs) {
+			if err := os.Remove(filepath.Join(j.RootDir, dir)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func Undo(notesRootDir string, wait bool) error {
+	journal, err := OpenJournal(notesRootDir)
+	if err != nil {
+		return fmt.Errorf("Failed to open journal: %w", err)
+	}
+
+	if err := journal.Undo(wait); err != nil {
+		return fmt.Errorf("Error undoing migration: %w", err)
+	}
+
+	return nil
+}
@@ -1,27 +1,19 @@
 package lib
 
 import (
-	"bufio"
 	"fmt"
 	"os"
-	"strings"
 )
 
-func readFileText(filePath string) (string, error) {
-	var fileText string
+func readNoteFile(filePath string, options ParseOptions) (NoteTree, error) {
+	var noteTree NoteTree
 
 	file, err := os.Open(filePath)
 	if err != nil {
-		return fileText, fmt.Errorf("Failed to open file: %w", err)
+		return noteTree, fmt.Errorf("Failed to open file: %w", err)
 	}
+	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	var fileLines []string
-	for scanner.Scan() {
-		fileLines = append(fileLines, scanner.Text())
-	}
-	fileText = strings.Join(fileLines, "\n")
-
-	return fileText, nil
+	options.File = filePath
+	return ParseNoteTreeReaderWithOptions(file, options)
 }
-
@@ -0,0 +1,105 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Open bullets are incomplete, and open bullets that are carried forward are copied to the new note file during a migration
+// When a bullet is migrated, it is replaced in the original note file by the bullet in MigratesTo
+type BulletDefinition struct {
+	Symbol string `json:"symbol"`
+	Name string `json:"name"`
+	Open bool `json:"open"`
+	MigratesTo string `json:"migrates_to"`
+	CarryForward bool `json:"carry_forward"`
+}
+
+var defaultBulletDefinitions = []BulletDefinition{
+	{Symbol: "-", Name: "note"},
+	{Symbol: "?", Name: "question"},
+	{Symbol: "*", Name: "task", Open: true, MigratesTo: ">", CarryForward: true},
+	{Symbol: "x", Name: "done"},
+	{Symbol: "~", Name: "cancelled"},
+	{Symbol: ">", Name: "migrated"},
+	{Symbol: "<", Name: "scheduled"},
+}
+
+type Vocabulary struct {
+	bullets []Bullet
+	definitions map[Bullet]BulletDefinition
+}
+
+var defaultVocabulary *Vocabulary = newVocabulary(defaultBulletDefinitions)
+
+// Later definitions replace earlier definitions with the same symbol
+func newVocabulary(definitions []BulletDefinition) *Vocabulary {
+	vocabulary := Vocabulary{definitions: make(map[Bullet]BulletDefinition)}
+	for _, definition := range(definitions) {
+		bullet, _ := utf8.DecodeRuneInString(definition.Symbol)
+		if _, ok := vocabulary.definitions[Bullet(bullet)]; !ok {
+			vocabulary.bullets = append(vocabulary.bullets, Bullet(bullet))
+		}
+
+		vocabulary.definitions[Bullet(bullet)] = definition
+	}
+
+	return &vocabulary
+}
+
+// Create a vocabulary with the default bullets, plus the given bullets
+func NewVocabulary(definitions []BulletDefinition) (*Vocabulary, error) {
+	for _, definition := range(definitions) {
+		if utf8.RuneCountInString(definition.Symbol) != 1 {
+			return nil, fmt.Errorf("Bullet %q must be a single character", definition.Symbol)
+		}
+
+		bullet, _ := utf8.DecodeRuneInString(definition.Symbol)
+		if unicode.IsSpace(bullet) || bullet == '\\' || bullet == '`' {
+			return nil, fmt.Errorf("Bullet %q can't be used as a bullet", definition.Symbol)
+		}
+	}
+
+	vocabulary := newVocabulary(append(append([]BulletDefinition(nil), defaultBulletDefinitions...), definitions...))
+	for _, definition := range(vocabulary.definitions) {
+		if definition.MigratesTo != "" {
+			if _, ok := vocabulary.Definition(bulletOf(definition.MigratesTo)); !ok || utf8.RuneCountInString(definition.MigratesTo) != 1 {
+				return nil, fmt.Errorf("Bullet %q migrates to unknown bullet %q", definition.Symbol, definition.MigratesTo)
+			}
+		}
+
+		// A bullet that is carried forward has to be closed in the file it is copied from, or it would be copied again by every migration
+		if !definition.CarryForward {
+			continue
+		} else if !definition.Open {
+			return nil, fmt.Errorf("Bullet %q is carried forward, so it must be open", definition.Symbol)
+		} else if migratesTo, _ := vocabulary.Definition(bulletOf(definition.MigratesTo)); definition.MigratesTo == "" || migratesTo.Open {
+			return nil, fmt.Errorf("Bullet %q is carried forward, so it must migrate to a bullet that isn't open", definition.Symbol)
+		}
+	}
+
+	return vocabulary, nil
+}
+
+func bulletOf(symbol string) Bullet {
+	bullet, _ := utf8.DecodeRuneInString(symbol)
+	return Bullet(bullet)
+}
+
+func (v *Vocabulary) Definition(bullet Bullet) (BulletDefinition, bool) {
+	definition, ok := v.definitions[bullet]
+	return definition, ok
+}
+
+// A regex that matches any one of the bullets
+func (v *Vocabulary) bulletRegexString() string {
+	var symbols []string
+	for _, bullet := range(v.bullets) {
+		symbols = append(symbols, regexp.QuoteMeta(bullet.String()))
+	}
+
+	return "(?:" + strings.Join(symbols, "|") + ")"
+}